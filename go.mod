@@ -1,6 +1,6 @@
 module github.com/simonswine/mi-flora-exporter
 
-go 1.15
+go 1.16
 
 require (
 	github.com/go-ble/ble v0.0.0-20200407180624-067514cd6e24
@@ -9,4 +9,5 @@ require (
 	github.com/prometheus/prometheus v1.8.2-0.20210331101223-3cafc58827d1 // v2.26.0
 	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli/v2 v2.3.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
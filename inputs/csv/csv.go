@@ -0,0 +1,175 @@
+package csv
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// Columns of the CSV input, the first line needs to contain their names.
+// Only address and timestamp are required.
+const (
+	columnTimestamp = "timestamp"
+	columnAddress   = "address"
+	columnName      = "name"
+	columnBattery   = "battery"
+	columnVersion   = "version"
+)
+
+// CSV reads results from CSV files with a header line.
+type CSV struct {
+	logger log.Logger
+	units  model.Units
+}
+
+func New(logger log.Logger) *CSV {
+	return &CSV{
+		logger: logger,
+		units:  model.DefaultUnits(),
+	}
+}
+
+// WithUnits sets the units of the measurement values.
+func (c *CSV) WithUnits(u model.Units) *CSV {
+	c.units = u
+	return c
+}
+
+// parseTimestamp accepts RFC 3339 and unix timestamps in seconds.
+func parseTimestamp(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp '%s'", v)
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), nil
+}
+
+type row struct {
+	columns map[string]int
+	values  []string
+}
+
+func (r *row) get(column string) string {
+	pos, ok := r.columns[column]
+	if !ok || pos >= len(r.values) {
+		return ""
+	}
+	return strings.TrimSpace(r.values[pos])
+}
+
+func (r *row) float(column string) (*float64, error) {
+	v := r.get(column)
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s '%s'", column, v)
+	}
+	return &f, nil
+}
+
+func (c *CSV) result(r *row) (*model.Result, error) {
+	address := r.get(columnAddress)
+	if address == "" {
+		return nil, fmt.Errorf("address is missing")
+	}
+	t, err := parseTimestamp(r.get(columnTimestamp))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]*float64, 4)
+	for _, field := range []string{model.FieldTemperature, model.FieldMoisture, model.FieldBrightness, model.FieldConductivity} {
+		v, err := r.float(field)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			values[field] = v
+		}
+	}
+
+	result := &model.Result{
+		Name:      r.get(columnName),
+		Address:   address,
+		Timestamp: &t,
+	}
+	if len(values) > 0 {
+		result.Measurement = model.NewMeasurement(
+			c.units,
+			values[model.FieldTemperature],
+			values[model.FieldMoisture],
+			values[model.FieldBrightness],
+			values[model.FieldConductivity],
+		)
+	}
+
+	battery, err := r.float(columnBattery)
+	if err != nil {
+		return nil, err
+	}
+	if battery != nil {
+		result.Firmware = &model.Firmware{
+			Battery: uint8(*battery),
+			Version: r.get(columnVersion),
+		}
+	}
+
+	return result, nil
+}
+
+// Read parses all records and sends them as results to out.
+func (c *CSV) Read(ctx context.Context, r io.Reader, out chan<- *model.Result) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for pos, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = pos
+	}
+	for _, required := range []string{columnTimestamp, columnAddress} {
+		if _, ok := columns[required]; !ok {
+			return fmt.Errorf("column '%s' is missing", required)
+		}
+	}
+
+	for record := 1; ; record++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error reading record: %w", err)
+		}
+
+		result, err := c.result(&row{columns: columns, values: values})
+		if err != nil {
+			return fmt.Errorf("error in record %d: %w", record, err)
+		}
+
+		select {
+		case out <- result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package csv
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func TestRead(t *testing.T) {
+	u, err := model.ParseUnits("", "microsiemens_per_centimeter", "")
+	require.NoError(t, err)
+
+	out := make(chan *model.Result, 16)
+	require.NoError(t, New(log.NewNopLogger()).WithUnits(u).Read(context.Background(), strings.NewReader(`Timestamp,Address,Name,Temperature,Moisture,Brightness,Conductivity,Battery,Version
+2021-05-01T10:00:00Z,c4:7c:8d:aa:bb:cc,fern,21.5,34,100,123,,
+# comments are ignored
+1619866800,c4:7c:8d:aa:bb:cc,fern,,,,,90,3.2.1
+`), out))
+	close(out)
+
+	var results []*model.Result
+	for r := range out {
+		results = append(results, r)
+	}
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "fern", results[0].Name)
+	assert.Equal(t, model.Temperature(215), *results[0].Measurement.Temperature)
+	assert.Equal(t, model.Conductivity(123), *results[0].Measurement.Conductivity)
+	assert.Nil(t, results[0].Firmware)
+
+	assert.True(t, time.Date(2021, 5, 1, 11, 0, 0, 0, time.UTC).Equal(*results[1].Timestamp))
+	assert.Nil(t, results[1].Measurement)
+	assert.Equal(t, &model.Firmware{Battery: 90, Version: "3.2.1"}, results[1].Firmware)
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, invalid := range []string{
+		"address,name\nc4:7c:8d:aa:bb:cc,fern\n",
+		"timestamp,address\nyesterday,c4:7c:8d:aa:bb:cc\n",
+		"timestamp,address,moisture\n2021-05-01T10:00:00Z,c4:7c:8d:aa:bb:cc,wet\n",
+	} {
+		out := make(chan *model.Result, 16)
+		assert.Error(t, New(log.NewNopLogger()).Read(context.Background(), strings.NewReader(invalid), out), invalid)
+	}
+}
@@ -0,0 +1,79 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// JSON reads results in the format written by the JSON output.
+type JSON struct {
+	logger log.Logger
+}
+
+func New(logger log.Logger) *JSON {
+	return &JSON{
+		logger: logger,
+	}
+}
+
+// result contains the measurements with explicit units. Measurements
+// without units use the default units.
+type result struct {
+	model.Result
+	Measurement    *model.UnitMeasurement `json:"measurement"`
+	RawMeasurement *model.UnitMeasurement `json:"raw_measurement"`
+}
+
+func (r *result) toModel() (*model.Result, error) {
+	out := r.Result
+	units := model.DefaultUnits()
+	if r.Measurement != nil {
+		m, err := r.Measurement.Measurement()
+		if err != nil {
+			return nil, err
+		}
+		out.Measurement = m
+		units, _ = r.Measurement.ParsedUnits()
+	}
+	if r.RawMeasurement != nil {
+		m, err := r.RawMeasurement.Measurement()
+		if err != nil {
+			return nil, err
+		}
+		out.RawMeasurement = m
+	}
+	for pos := range out.Conditions {
+		out.Conditions[pos] = units.ConvertConditionFrom(out.Conditions[pos])
+	}
+	return &out, nil
+}
+
+// Read decodes all results and sends them to out.
+func (j *JSON) Read(ctx context.Context, r io.Reader, out chan<- *model.Result) error {
+	dec := json.NewDecoder(r)
+	for pos := 1; ; pos++ {
+		var res result
+		if err := dec.Decode(&res); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error decoding result %d: %w", pos, err)
+		}
+
+		r, err := res.toModel()
+		if err != nil {
+			return fmt.Errorf("error decoding result %d: %w", pos, err)
+		}
+
+		select {
+		case out <- r:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
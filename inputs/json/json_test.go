@@ -0,0 +1,85 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	jsonoutput "github.com/simonswine/mi-flora-exporter/outputs/json"
+)
+
+func read(t *testing.T, input string) []*model.Result {
+	out := make(chan *model.Result, 16)
+	require.NoError(t, New(log.NewNopLogger()).Read(context.Background(), strings.NewReader(input), out))
+	close(out)
+
+	var results []*model.Result
+	for r := range out {
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestRead(t *testing.T) {
+	results := read(t, `
+{"name":"fern","address":"c4:7c:8d:aa:bb:cc","timestamp":"2021-05-01T10:00:00Z","measurement":{"temperature":21.5,"moisture":34,"brightness":100,"conductivity":0.0123}}
+{"address":"c4:7c:8d:aa:bb:cc","measurement":{"temperature":70.7,"conductivity":123,"units":{"temperature":"fahrenheit","conductivity":"microsiemens_per_centimeter"}},"conditions":[{"dimension":"temperature","state":"ok","value":70.7,"min":59}]}
+{"address":"c4:7c:8d:aa:bb:dd","firmware":{"version":"3.2.1","battery":90}}
+`)
+	require.Len(t, results, 3)
+
+	assert.Equal(t, "fern", results[0].Name)
+	assert.Equal(t, time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC), *results[0].Timestamp)
+	assert.Equal(t, model.Temperature(215), *results[0].Measurement.Temperature)
+	assert.Equal(t, model.Conductivity(123), *results[0].Measurement.Conductivity)
+
+	assert.Equal(t, model.Temperature(215), *results[1].Measurement.Temperature)
+	assert.Equal(t, model.Conductivity(123), *results[1].Measurement.Conductivity)
+	assert.Nil(t, results[1].Measurement.Moisture)
+	assert.InDelta(t, 15.0, *results[1].Conditions[0].Min, 1e-9)
+
+	assert.Equal(t, uint8(90), results[2].Firmware.Battery)
+
+	out := make(chan *model.Result, 1)
+	assert.Error(t, New(log.NewNopLogger()).Read(context.Background(), strings.NewReader(`{"measurement":{"units":{"temperature":"rankine"}}}`), out))
+}
+
+func TestRoundTrip(t *testing.T) {
+	u, err := model.ParseUnits("kelvin", "microsiemens_per_centimeter", "foot_candles")
+	require.NoError(t, err)
+
+	ts := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	temperature := model.Temperature(-35)
+	moisture := uint8(34)
+	brightness := uint16(12345)
+	conductivity := model.Conductivity(987)
+	in := &model.Result{
+		Name:      "fern",
+		Address:   "c4:7c:8d:aa:bb:cc",
+		Timestamp: &ts,
+		Measurement: &model.Measurement{
+			Temperature:  &temperature,
+			Moisture:     &moisture,
+			Brightness:   &brightness,
+			Conductivity: &conductivity,
+		},
+	}
+
+	var buf bytes.Buffer
+	resultCh, errCh, err := jsonoutput.New(log.NewNopLogger()).WithUnits(u).Run(context.Background(), &buf)
+	require.NoError(t, err)
+	resultCh <- in
+	close(resultCh)
+	require.NoError(t, <-errCh)
+
+	results := read(t, buf.String())
+	require.Len(t, results, 1)
+	assert.Equal(t, in, results[0])
+}
@@ -4,17 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	stdlog "log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/go-ble/ble/linux"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/urfave/cli/v2"
 
+	csvinput "github.com/simonswine/mi-flora-exporter/inputs/csv"
+	jsoninput "github.com/simonswine/mi-flora-exporter/inputs/json"
 	"github.com/simonswine/mi-flora-exporter/miflora"
-	mcontext "github.com/simonswine/mi-flora-exporter/miflora/context"
+	"github.com/simonswine/mi-flora-exporter/miflora/alerting"
+	"github.com/simonswine/mi-flora-exporter/miflora/calibration"
+	"github.com/simonswine/mi-flora-exporter/miflora/forecast"
+	"github.com/simonswine/mi-flora-exporter/miflora/light"
 	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	"github.com/simonswine/mi-flora-exporter/miflora/pipeline"
+	"github.com/simonswine/mi-flora-exporter/miflora/plants"
+	"github.com/simonswine/mi-flora-exporter/miflora/watering"
 	"github.com/simonswine/mi-flora-exporter/outputs/json"
 	"github.com/simonswine/mi-flora-exporter/outputs/tsdb"
 )
@@ -30,7 +42,7 @@ func scanFlags(scanPassiveDefault bool) []cli.Flag {
 		},
 		&cli.DurationFlag{
 			Name:  "scan-timeout",
-			Value: mcontext.ScanTimeoutFromContext(context.Background()),
+			Value: miflora.DefaultOptions().Scan.Timeout,
 			Usage: "Timeout after which scanning for sensor devices is stopped.",
 		},
 		&cli.BoolFlag{
@@ -40,7 +52,7 @@ func scanFlags(scanPassiveDefault bool) []cli.Flag {
 		},
 		&cli.Int64Flag{
 			Name:  "expected-sensors",
-			Value: mcontext.ExpectedSensorsFromContext(context.Background()),
+			Value: miflora.DefaultOptions().Scan.ExpectedSensors,
 			Usage: "If set to a value > 0 sensor scanning will stop after this number of sensors are detected.",
 		},
 		&cli.StringSliceFlag{
@@ -50,6 +62,85 @@ func scanFlags(scanPassiveDefault bool) []cli.Flag {
 	}
 }
 
+var sessionFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "concurrency",
+		Value: miflora.DefaultOptions().Sessions.Concurrency,
+		Usage: "Number of sensors connected to at the same time. Sensors with the strongest signal are connected to first.",
+	},
+	&cli.DurationFlag{
+		Name:  "sensor-timeout",
+		Value: miflora.DefaultOptions().Sessions.SensorTimeout,
+		Usage: "Timeout for a single connection to a sensor.",
+	},
+	&cli.IntFlag{
+		Name:  "retry.attempts",
+		Value: miflora.DefaultRetryPolicy().Attempts,
+		Usage: "Maximum number of attempts of an operation on a sensor, transient errors are retried.",
+	},
+	&cli.DurationFlag{
+		Name:  "retry.backoff",
+		Value: miflora.DefaultRetryPolicy().Backoff,
+		Usage: "Wait time before the first retry, it doubles with every further retry.",
+	},
+	&cli.DurationFlag{
+		Name:  "retry.max-backoff",
+		Value: miflora.DefaultRetryPolicy().MaxBackoff,
+		Usage: "Maximum wait time between retries.",
+	},
+	&cli.IntFlag{
+		Name:  "circuit-breaker.failures",
+		Value: miflora.DefaultCircuitBreakerFailures,
+		Usage: "Number of consecutive failed connections after which a sensor is skipped. 0 disables the circuit breaker.",
+	},
+	&cli.DurationFlag{
+		Name:  "circuit-breaker.cooldown",
+		Value: miflora.DefaultCircuitBreakerCooldown,
+		Usage: "Duration for which a sensor is skipped after consecutive failed connections.",
+	},
+	&cli.StringFlag{
+		Name:  "metrics.listen-address",
+		Usage: "Address to serve the metrics about connections, history downloads and sensor clocks on, while the command runs. Metrics are not served if empty. (Example: ':9295')",
+	},
+	&cli.StringFlag{
+		Name:  "clock.state-file",
+		Usage: "Path to a file, which keeps the device time observed from sensors across runs. It is used to estimate the drift of the sensor clocks and to correct the timestamps of history records.",
+	},
+}
+
+var historyFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "history.batch-size",
+		Value: miflora.DefaultBatchConfig().Size,
+		Usage: "Number of history records read from a sensor per connection.",
+	},
+	&cli.StringSliceFlag{
+		Name:  "history.sensor-batch-size",
+		Usage: "Batch size for a single sensor, identified by its name or address. Can be repeated. (Example: 'my-bedroom-plant=200')",
+	},
+	&cli.BoolFlag{
+		Name:  "history.adaptive-batch-size",
+		Usage: "Grow the batch size while reads succeed quickly and shrink it after timeouts or disconnects.",
+	},
+	&cli.IntFlag{
+		Name:  "history.max-batch-size",
+		Value: miflora.DefaultBatchConfig().MaxSize,
+		Usage: "Maximum batch size of the adaptive batch size.",
+	},
+	&cli.StringFlag{
+		Name:  "since",
+		Usage: "Only download records at or after this time (RFC 3339 or a duration ago, e.g. 24h). Older records are not read from the sensors.",
+	},
+	&cli.StringFlag{
+		Name:  "until",
+		Usage: "Only download records at or before this time (RFC 3339 or a duration ago, e.g. 24h).",
+	},
+	&cli.IntFlag{
+		Name:  "max-records",
+		Usage: "If set to a value > 0, stop reading the history of a sensor after this number of records.",
+	},
+}
+
 var outputFlags = []cli.Flag{
 	&cli.StringFlag{
 		Name:  "output",
@@ -63,12 +154,299 @@ var outputFlags = []cli.Flag{
 	},
 }
 
-func scanContext(c *cli.Context, ctx context.Context) context.Context {
-	ctx = mcontext.ContextWithExpectedSensors(ctx, c.Int64("expected-sensors"))
-	ctx = mcontext.ContextWithScanTimeout(ctx, c.Duration("scan-timeout"))
-	ctx = mcontext.ContextWithScanPassive(ctx, c.Bool("scan-passive"))
-	ctx = mcontext.ContextWithSensorNames(ctx, c.StringSlice("sensor-name"))
-	return ctx
+var unitFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "units.temperature",
+		Value: string(model.DefaultUnits().Temperature),
+		Usage: "Unit of the temperature (celsius|fahrenheit|kelvin).",
+	},
+	&cli.StringFlag{
+		Name:  "units.conductivity",
+		Value: string(model.DefaultUnits().Conductivity),
+		Usage: "Unit of the conductivity (siemens_per_meter|microsiemens_per_centimeter).",
+	},
+	&cli.StringFlag{
+		Name:  "units.brightness",
+		Value: string(model.DefaultUnits().Brightness),
+		Usage: "Unit of the brightness (lux|foot_candles).",
+	},
+}
+
+var processingFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "calibration",
+		Usage: "Path to a YAML file with per sensor calibrations of the measured values.",
+	},
+	&cli.BoolFlag{
+		Name:  "calibration.keep-raw",
+		Usage: "Keep the uncalibrated measurement alongside the calibrated one.",
+	},
+	&cli.StringFlag{
+		Name:  "plant-profiles",
+		Usage: "Path to a YAML file with additional plant profiles, they replace bundled profiles of the same species.",
+	},
+	&cli.StringSliceFlag{
+		Name:  "sensor-species",
+		Usage: "Assign a sensor to a plant species to evaluate its conditions. Can be repeated. (Example: 'my-bedroom-plant=ficus lyrata')",
+	},
+	&cli.BoolFlag{
+		Name:  "watering-detection",
+		Usage: "Detect waterings by sharp increases of the moisture.",
+	},
+	&cli.Float64Flag{
+		Name:  "watering.min-increase",
+		Value: watering.DefaultConfig().MinIncrease,
+		Usage: "Increase of moisture in percentage points required to detect a watering.",
+	},
+	&cli.DurationFlag{
+		Name:  "watering.window",
+		Value: watering.DefaultConfig().Window,
+		Usage: "Time span in which the increase of moisture needs to happen.",
+	},
+	&cli.DurationFlag{
+		Name:  "watering.debounce",
+		Value: watering.DefaultConfig().Debounce,
+		Usage: "Minimum time between two detected waterings.",
+	},
+	&cli.BoolFlag{
+		Name:  "light-integral",
+		Usage: "Integrate the brightness to the daily light integral and light hours.",
+	},
+	&cli.Float64Flag{
+		Name:  "light.lux-to-ppfd",
+		Value: light.DefaultConfig().LuxToPPFD,
+		Usage: "Factor converting lux to PPFD in µmol/m²/s, it depends on the light source.",
+	},
+	&cli.Float64Flag{
+		Name:  "light.threshold",
+		Value: light.DefaultConfig().Threshold,
+		Usage: "Brightness in lux above which light hours are counted.",
+	},
+	&cli.DurationFlag{
+		Name:  "light.max-gap",
+		Value: light.DefaultConfig().MaxGap,
+		Usage: "Longest time between two measurements which is interpolated.",
+	},
+	&cli.BoolFlag{
+		Name:  "moisture-forecast",
+		Usage: "Predict when the moisture falls below the minimum of the plant species.",
+	},
+	&cli.Float64Flag{
+		Name:  "moisture-forecast.threshold",
+		Usage: "Moisture in percent used for the prediction of sensors without a plant species.",
+	},
+}
+
+func newPipeline(c *cli.Context) (pipeline.Pipeline, error) {
+	var p pipeline.Pipeline
+
+	if path := c.String("calibration"); path != "" {
+		calibrator := calibration.New().WithKeepRaw(c.Bool("calibration.keep-raw"))
+		if err := calibrator.LoadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to load calibrations: %w", err)
+		}
+		p = append(p, calibrator)
+	}
+
+	if assignments := c.StringSlice("sensor-species"); len(assignments) > 0 {
+		db := plants.New()
+		if path := c.String("plant-profiles"); path != "" {
+			if err := db.LoadFile(path); err != nil {
+				return nil, fmt.Errorf("failed to load plant profiles: %w", err)
+			}
+		}
+		evaluator, err := plants.NewEvaluator(db, assignments)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, evaluator)
+	}
+
+	if c.Bool("watering-detection") {
+		p = append(p, watering.New(watering.Config{
+			MinIncrease: c.Float64("watering.min-increase"),
+			Window:      c.Duration("watering.window"),
+			Debounce:    c.Duration("watering.debounce"),
+		}))
+	}
+
+	if c.Bool("light-integral") {
+		p = append(p, light.New(light.Config{
+			LuxToPPFD: c.Float64("light.lux-to-ppfd"),
+			Threshold: c.Float64("light.threshold"),
+			MaxGap:    c.Duration("light.max-gap"),
+		}))
+	}
+
+	if c.Bool("moisture-forecast") {
+		cfg := forecast.DefaultConfig()
+		cfg.Threshold = c.Float64("moisture-forecast.threshold")
+		p = append(p, forecast.New(cfg))
+	}
+
+	return p, nil
+}
+
+func scanOptions(c *cli.Context) []miflora.Option {
+	return []miflora.Option{
+		miflora.WithExpectedSensors(c.Int64("expected-sensors")),
+		miflora.WithScanTimeout(c.Duration("scan-timeout")),
+		miflora.WithScanPassive(c.Bool("scan-passive")),
+		miflora.WithSensorNames(c.StringSlice("sensor-name")...),
+	}
+}
+
+func sessionOptions(c *cli.Context) ([]miflora.Option, error) {
+	clock, err := miflora.NewClockTracker(c.String("clock.state-file"))
+	if err != nil {
+		return nil, err
+	}
+
+	retry := miflora.DefaultRetryPolicy()
+	retry.Attempts = c.Int("retry.attempts")
+	retry.Backoff = c.Duration("retry.backoff")
+	retry.MaxBackoff = c.Duration("retry.max-backoff")
+
+	return []miflora.Option{
+		miflora.WithConcurrency(c.Int("concurrency")),
+		miflora.WithSensorTimeout(c.Duration("sensor-timeout")),
+		miflora.WithMetricsListenAddress(c.String("metrics.listen-address")),
+		miflora.WithClockTracker(clock),
+		miflora.WithRetryPolicy(retry),
+		miflora.WithCircuitBreaker(c.Int("circuit-breaker.failures"), c.Duration("circuit-breaker.cooldown")),
+	}, nil
+}
+
+func historyOptions(c *cli.Context) ([]miflora.Option, error) {
+	since, err := parseTimeFlag(c, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseTimeFlag(c, "until")
+	if err != nil {
+		return nil, err
+	}
+
+	batch := miflora.DefaultBatchConfig()
+	batch.Size = c.Int("history.batch-size")
+	batch.Adaptive = c.Bool("history.adaptive-batch-size")
+	batch.MaxSize = c.Int("history.max-batch-size")
+	batch.Sizes, err = miflora.ParseBatchSizes(c.StringSlice("history.sensor-batch-size"))
+	if err != nil {
+		return nil, err
+	}
+
+	return []miflora.Option{
+		miflora.WithHistoryWindow(since, until),
+		miflora.WithHistoryMaxRecords(c.Int("max-records")),
+		miflora.WithHistoryBatch(batch),
+	}, nil
+}
+
+func parseUnits(c *cli.Context) (model.Units, error) {
+	return model.ParseUnits(c.String("units.temperature"), c.String("units.conductivity"), c.String("units.brightness"))
+}
+
+var convertFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "input-format",
+		Usage: "Format of the inputs (json|csv), by default it is derived from the file extension.",
+	},
+	&cli.StringFlag{
+		Name:  "since",
+		Usage: "Only convert results at or after this time (RFC 3339 or a duration ago, e.g. 24h).",
+	},
+	&cli.StringFlag{
+		Name:  "until",
+		Usage: "Only convert results at or before this time (RFC 3339 or a duration ago, e.g. 24h).",
+	},
+	&cli.StringSliceFlag{
+		Name:  "sensor",
+		Usage: "Only convert results of this sensor name or address. Can be repeated.",
+	},
+	&cli.BoolFlag{
+		Name:  "dedup",
+		Value: true,
+		Usage: "Drop results already seen for the same sensor and time.",
+	},
+}
+
+// parseTimeFlag parses a time given either in RFC 3339 or as a duration
+// before now. An unset flag returns the zero time.
+func parseTimeFlag(c *cli.Context, name string) (time.Time, error) {
+	v := c.String(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, expected RFC 3339 or a duration: %w", name, err)
+	}
+	return t, nil
+}
+
+func newConvertPipeline(c *cli.Context) (pipeline.Pipeline, error) {
+	filter := &pipeline.Filter{Sensors: c.StringSlice("sensor")}
+	var err error
+	if filter.Since, err = parseTimeFlag(c, "since"); err != nil {
+		return nil, err
+	}
+	if filter.Until, err = parseTimeFlag(c, "until"); err != nil {
+		return nil, err
+	}
+
+	p := pipeline.Pipeline{filter}
+	if c.Bool("dedup") {
+		p = append(p, pipeline.NewDeduplicator())
+	}
+	return p, nil
+}
+
+// readInputs reads results from the files given as arguments or stdin.
+func readInputs(ctx context.Context, c *cli.Context, logger log.Logger, units model.Units, out chan<- *model.Result) error {
+	paths := c.Args().Slice()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	for _, path := range paths {
+		format := c.String("input-format")
+		if format == "" {
+			format = "json"
+			if strings.EqualFold(filepath.Ext(path), ".csv") {
+				format = "csv"
+			}
+		}
+
+		var read func(context.Context, io.Reader, chan<- *model.Result) error
+		switch format {
+		case "json":
+			read = jsoninput.New(logger).Read
+		case "csv":
+			read = csvinput.New(logger).WithUnits(units).Read
+		default:
+			return fmt.Errorf("unknown input format '%s'", format)
+		}
+
+		if err := func() error {
+			r := io.Reader(os.Stdin)
+			if path != "-" {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			return read(ctx, r, out)
+		}(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+	return nil
 }
 
 func filterContextErr(err error) error {
@@ -84,39 +462,56 @@ func main() {
 	logger = log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
 	stdlog.SetOutput(log.NewStdlibAdapter(level.Debug(logger)))
 
-	newMiraFlora := func(c *cli.Context) (context.Context, *miflora.MiFlora) {
+	newMiraFlora := func(c *cli.Context, p pipeline.Pipeline, opts ...miflora.Option) (*miflora.MiFlora, error) {
+		units, err := parseUnits(c)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(append(scanOptions(c),
+			miflora.WithUnits(units),
+			miflora.WithProcessors(p...),
+			miflora.WithDeviceOpener(func() (*linux.Device, error) {
+				return linux.NewDevice()
+			}),
+		), opts...)
+
 		device := c.String("adapter")
 		d, err := linux.NewDevice()
 		if err != nil {
 			_ = level.Error(logger).Log("msg", fmt.Sprintf("failed to get %s device", device), "error", err)
 			os.Exit(1)
 		}
-		ctx := scanContext(c, context.Background())
-		return ctx, miflora.New(d).WithLogger(logger)
+		m, err := miflora.New(d, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return m.WithLogger(logger), nil
 	}
 
-	setupOutput := func(ctx context.Context, c *cli.Context) (context.Context, func() error, error) {
+	// setupOutput runs the pipeline in front of the output, the results are
+	// sent to the returned channel.
+	setupOutput := func(ctx context.Context, c *cli.Context, units model.Units, p pipeline.Pipeline) (context.Context, chan<- *model.Result, func() error, error) {
 		var resultCh chan *model.Result
 		var errCh chan error
 		var err error
 
 		switch outputType := c.String("output"); outputType {
 		case "json":
-			resultCh, errCh, err = json.New(logger).Run(ctx, os.Stdout)
+			resultCh, errCh, err = json.New(logger).WithUnits(units).Run(ctx, os.Stdout)
 		case "tsdb":
-			resultCh, errCh, err = tsdb.New(logger).Run(ctx, c.String("tsdb.path"))
+			resultCh, errCh, err = tsdb.New(logger).WithUnits(units).Run(ctx, c.String("tsdb.path"))
 		default:
-			return nil, nil, fmt.Errorf("unknown output '%s", outputType)
+			return nil, nil, nil, fmt.Errorf("unknown output '%s", outputType)
 		}
 
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 
-		ctx = mcontext.ContextWithResultChannel(ctx, resultCh)
-
 		ctx, cancel := context.WithCancel(ctx)
 
+		inputCh := p.Run(ctx, resultCh)
+
 		errResult := make(chan error)
 
 		go func() {
@@ -133,9 +528,10 @@ func main() {
 			errResult <- err
 		}()
 
-		return ctx,
+		return ctx, inputCh,
 			func() error {
-				//close(resultCh)
+				// closing the input flushes the output
+				close(inputCh)
 				return <-errResult
 			}, nil
 	}
@@ -150,8 +546,11 @@ func main() {
 				Usage:   "scan for sensors reachable by bluetooth",
 				Action: func(c *cli.Context) error {
 					_ = logger.Log("msg", "scanning for available bluetooth sensors")
-					ctx, m := newMiraFlora(c)
-					if err := m.Scan(ctx); err != nil {
+					m, err := newMiraFlora(c, nil)
+					if err != nil {
+						return err
+					}
+					if err := m.Scan(context.Background()); err != nil {
 						return err
 					}
 					return nil
@@ -160,17 +559,55 @@ func main() {
 			{
 				Name:    "exporter",
 				Aliases: []string{"e"},
-				Flags: append(scanFlags(true), &cli.StringFlag{
-					Name:    "bind-address",
-					Aliases: []string{"addr"},
-					Value:   mcontext.BindAddressFromContext(context.Background()),
-					Usage:   "Listen address for exporter.",
-				}),
+				Flags: append(append(append(scanFlags(true), processingFlags...), unitFlags...),
+					&cli.StringFlag{
+						Name:    "bind-address",
+						Aliases: []string{"addr"},
+						Value:   miflora.DefaultOptions().Exporter.BindAddress,
+						Usage:   "Listen address for exporter.",
+					},
+					&cli.BoolFlag{
+						Name:  "metrics-timestamps",
+						Value: miflora.DefaultOptions().Exporter.MetricsTimestamps,
+						Usage: "Expose samples with the time the advertisement has been received, instead of the time of the scrape.",
+					},
+					&cli.DurationFlag{
+						Name:  "ready-window",
+						Value: miflora.DefaultOptions().Exporter.ReadyWindow,
+						Usage: "The exporter is only ready, if an advertisement has been received within this duration.",
+					},
+					&cli.StringFlag{
+						Name:  "alerting.config",
+						Usage: "Path to a YAML file with alerting rules and notifiers.",
+					},
+				),
 				Usage: "run prometheus exporter",
 				Action: func(c *cli.Context) error {
-					ctx, m := newMiraFlora(c)
-					ctx = mcontext.ContextWithBindAddress(ctx, c.String("bind-address"))
-					if err := m.Exporter(ctx); err != nil {
+					p, err := newPipeline(c)
+					if err != nil {
+						return err
+					}
+					opts := []miflora.Option{
+						miflora.WithBindAddress(c.String("bind-address")),
+						miflora.WithMetricsTimestamps(c.Bool("metrics-timestamps")),
+						miflora.WithReadyWindow(c.Duration("ready-window")),
+					}
+					if path := c.String("alerting.config"); path != "" {
+						cfg, err := alerting.LoadFile(path)
+						if err != nil {
+							return fmt.Errorf("failed to load alerting config: %w", err)
+						}
+						engine, err := alerting.New(cfg)
+						if err != nil {
+							return err
+						}
+						opts = append(opts, miflora.WithAlerting(engine))
+					}
+					m, err := newMiraFlora(c, p, opts...)
+					if err != nil {
+						return err
+					}
+					if err := m.Exporter(context.Background()); err != nil {
 						return err
 					}
 					return nil
@@ -179,13 +616,30 @@ func main() {
 			{
 				Name:    "realtime",
 				Aliases: []string{"r"},
-				Flags:   append(scanFlags(false), outputFlags...),
+				Flags:   append(append(append(append(scanFlags(false), sessionFlags...), processingFlags...), unitFlags...), outputFlags...),
 				Usage:   "receive realtime values from sensors",
 				Action: func(c *cli.Context) error {
-					ctx, m := newMiraFlora(c)
+					p, err := newPipeline(c)
+					if err != nil {
+						return err
+					}
+					units, err := parseUnits(c)
+					if err != nil {
+						return err
+					}
+					opts, err := sessionOptions(c)
+					if err != nil {
+						return err
+					}
+
+					ctx, results, finish, err := setupOutput(context.Background(), c, units, p)
+					if err != nil {
+						return err
+					}
 
-					ctx, finish, err := setupOutput(ctx, c)
+					m, err := newMiraFlora(c, p, append(opts, miflora.WithResults(results))...)
 					if err != nil {
+						_ = finish()
 						return err
 					}
 
@@ -197,16 +651,65 @@ func main() {
 
 				},
 			},
+			{
+				Name:      "convert",
+				Aliases:   []string{"c"},
+				Flags:     append(append(append([]cli.Flag{}, convertFlags...), unitFlags...), outputFlags...),
+				Usage:     "convert recorded results from JSON or CSV files to an output, the units select the units of CSV inputs and of the output",
+				ArgsUsage: "[file...]",
+				Action: func(c *cli.Context) error {
+					units, err := parseUnits(c)
+					if err != nil {
+						return err
+					}
+					p, err := newConvertPipeline(c)
+					if err != nil {
+						return err
+					}
+
+					ctx, results, finish, err := setupOutput(context.Background(), c, units, p)
+					if err != nil {
+						return err
+					}
+
+					readErr := filterContextErr(readInputs(ctx, c, logger, units, results))
+					if err := finish(); err != nil {
+						return err
+					}
+					return readErr
+				},
+			},
 			{
 				Name:    "history",
 				Aliases: []string{"H"},
-				Flags:   append(scanFlags(false), outputFlags...),
+				Flags:   append(append(append(append(append(scanFlags(false), sessionFlags...), historyFlags...), processingFlags...), unitFlags...), outputFlags...),
 				Usage:   "receive historic values from sensors",
 				Action: func(c *cli.Context) error {
-					ctx, m := newMiraFlora(c)
+					p, err := newPipeline(c)
+					if err != nil {
+						return err
+					}
+					units, err := parseUnits(c)
+					if err != nil {
+						return err
+					}
+					opts, err := sessionOptions(c)
+					if err != nil {
+						return err
+					}
+					historyOpts, err := historyOptions(c)
+					if err != nil {
+						return err
+					}
+
+					ctx, results, finish, err := setupOutput(context.Background(), c, units, p)
+					if err != nil {
+						return err
+					}
 
-					ctx, finish, err := setupOutput(ctx, c)
+					m, err := newMiraFlora(c, p, append(append(opts, historyOpts...), miflora.WithResults(results))...)
 					if err != nil {
+						_ = finish()
 						return err
 					}
 
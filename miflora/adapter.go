@@ -0,0 +1,107 @@
+package miflora
+
+import (
+	"context"
+	"sync"
+)
+
+// adapterLock serializes all uses of the adapter: scanning, establishing
+// connections and reopening it. Scans give way to connections, a running
+// scan is canceled as soon as somebody waits for the adapter and is only
+// resumed once nobody is waiting anymore.
+type adapterLock struct {
+	sem chan struct{}
+
+	mu      sync.Mutex
+	waiters int
+	// idle is closed once the last waiter acquired the lock
+	idle       chan struct{}
+	cancelScan context.CancelFunc
+}
+
+func newAdapterLock() *adapterLock {
+	return &adapterLock{
+		sem: make(chan struct{}, 1),
+	}
+}
+
+// lock waits until the adapter is available, a running scan is paused. The
+// returned function releases the lock again.
+func (l *adapterLock) lock(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	l.waiters++
+	if l.waiters == 1 {
+		l.idle = make(chan struct{})
+	}
+	if l.cancelScan != nil {
+		l.cancelScan()
+	}
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			close(l.idle)
+		}
+		l.mu.Unlock()
+	}()
+
+	select {
+	case l.sem <- struct{}{}:
+		return func() { <-l.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lockScan waits until nobody else is waiting for the adapter and locks it
+// for scanning. The returned context is canceled as soon as somebody else
+// waits for the adapter, the returned function releases the lock again.
+func (l *adapterLock) lockScan(ctx context.Context) (context.Context, func(), error) {
+	for {
+		l.mu.Lock()
+		if l.waiters > 0 {
+			idle := l.idle
+			l.mu.Unlock()
+			select {
+			case <-idle:
+				continue
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+		l.mu.Unlock()
+
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+
+		l.mu.Lock()
+		if l.waiters > 0 {
+			// somebody started waiting in the meantime
+			l.mu.Unlock()
+			<-l.sem
+			continue
+		}
+		scanCtx, cancel := context.WithCancel(ctx)
+		l.cancelScan = cancel
+		l.mu.Unlock()
+
+		return scanCtx, func() {
+			l.mu.Lock()
+			l.cancelScan = nil
+			l.mu.Unlock()
+			cancel()
+			<-l.sem
+		}, nil
+	}
+}
+
+// lockConn waits until nobody else is using the adapter, a running scan is
+// paused until the returned function released the lock again.
+func (m *MiFlora) lockConn(ctx context.Context) (func(), error) {
+	return m.adapter.lock(ctx)
+}
@@ -0,0 +1,68 @@
+package miflora
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdapterLockPausesScan(t *testing.T) {
+	l := newAdapterLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scanCtx, unlockScan, err := l.lockScan(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := l.lock(ctx)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		locked <- unlock
+	}()
+
+	// the scan is canceled once somebody waits for the adapter
+	select {
+	case <-scanCtx.Done():
+	case <-ctx.Done():
+		t.Fatal("scan not canceled")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("parent context canceled")
+	}
+	unlockScan()
+	unlock := <-locked
+
+	// the scan only resumes after the connection released the adapter
+	resumed := make(chan func())
+	go func() {
+		_, unlockScan, err := l.lockScan(ctx)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		resumed <- unlockScan
+	}()
+	select {
+	case <-resumed:
+		t.Fatal("scan resumed while adapter is locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	(<-resumed)()
+
+	// a canceled context stops waiting
+	_, unlockScan, err = l.lockScan(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer unlockScan()
+	waitCtx, waitCancel := context.WithCancel(ctx)
+	waitCancel()
+	if _, err := l.lock(waitCtx); err != context.Canceled {
+		t.Errorf("unexpected error exp: %v, act: %v", context.Canceled, err)
+	}
+}
@@ -35,10 +35,26 @@ const (
 	measurementTemperatureAndHumidity measurementIDs = 0x100d // 2 byte temperature / 10, 2 byte humidity / 10
 )
 
+var (
+	ErrFrameTooShort       = errors.New("A miflora advertisement frame must be at least 5 bytes long")
+	ErrNotMeasurement      = errors.New("not a measurement")
+	ErrMeasurementTooShort = errors.New("measurement too short")
+)
+
+// UnknownMeasurementError is returned for measurement object IDs, which can't
+// be decoded.
+type UnknownMeasurementError struct {
+	ID uint16
+}
+
+func (e *UnknownMeasurementError) Error() string {
+	return fmt.Sprintf("unknown measurement: %x", e.ID)
+}
+
 func New(d []byte) (*XiaomiData, error) {
 
 	if len(d) < 5 {
-		return nil, errors.New("A miflora advertisement frame must be at least 5 bytes long")
+		return nil, ErrFrameTooShort
 	}
 
 	return &XiaomiData{
@@ -74,7 +90,7 @@ func (x *XiaomiData) hasMacAddress() bool {
 	return (x.flags() & flagMacAddress) != 0
 }
 
-func (x *XiaomiData) hasCapabilities() bool {
+func (x *XiaomiData) HasCapabilities() bool {
 	return (x.flags() & flagCapabilities) != 0
 }
 
@@ -134,28 +150,58 @@ func (x *XiaomiData) Capabilities() byte {
 
 func (x *XiaomiData) valuesOffset() int {
 	offset := x.capabiltiesOffset()
-	if x.hasCapabilities() {
+	if x.HasCapabilities() {
 		offset += 1
 	}
 	return offset
 }
 
-func (x *XiaomiData) Measurement() (*model.Measurement, error) {
+// MeasurementID returns the object ID of the measurement contained in the
+// frame.
+func (x *XiaomiData) MeasurementID() (uint16, error) {
 	if !x.HasMeasurement() {
-		return nil, errors.New("not a measurement")
+		return 0, ErrNotMeasurement
 	}
 	offset := x.valuesOffset()
 	end := offset + 2
 	if len(x.data) < end {
-		return nil, fmt.Errorf("invalid measurement, length=%d exprect=%d: %v", len(x.data), end, x.data)
+		return 0, fmt.Errorf("%w, length=%d exprect=%d: %v", ErrMeasurementTooShort, len(x.data), end, x.data)
+	}
+	return binary.LittleEndian.Uint16(x.data[offset:end]), nil
+}
+
+func (x *XiaomiData) Measurement() (*model.Measurement, error) {
+	rawID, err := x.MeasurementID()
+	if err != nil {
+		return nil, err
 	}
-	id := measurementIDs(binary.LittleEndian.Uint16(x.data[offset:end]))
-	offset += 2
+	id := measurementIDs(rawID)
+	offset := x.valuesOffset() + 2
 
+	if len(x.data) <= offset {
+		return nil, fmt.Errorf("%w, length=%d exprect=%d: %v", ErrMeasurementTooShort, len(x.data), offset+1, x.data)
+	}
 	length := x.data[offset]
 
 	offset += 1
-	data := x.data[offset : offset+int(length)]
+	end := offset + int(length)
+	if len(x.data) < end {
+		return nil, fmt.Errorf("%w, length=%d exprect=%d: %v", ErrMeasurementTooShort, len(x.data), end, x.data)
+	}
+	data := x.data[offset:end]
+
+	var expectedLength int
+	switch id {
+	case measurementTemperature, measurementBrightness, measurementFertility:
+		expectedLength = 2
+	case measurementMoisture:
+		expectedLength = 1
+	default:
+		return nil, &UnknownMeasurementError{ID: rawID}
+	}
+	if len(data) < expectedLength {
+		return nil, fmt.Errorf("%w, value length=%d exprect=%d: %v", ErrMeasurementTooShort, len(data), expectedLength, x.data)
+	}
 
 	var measurement model.Measurement
 
@@ -172,8 +218,6 @@ func (x *XiaomiData) Measurement() (*model.Measurement, error) {
 	case measurementFertility:
 		val := model.Conductivity(binary.LittleEndian.Uint16(data))
 		measurement.Conductivity = &val
-	default:
-		return nil, fmt.Errorf("unknown measurement: %x", id)
 	}
 
 	return &measurement, nil
@@ -14,7 +14,7 @@ func verifyFloraNormal(t *testing.T, d *XiaomiData) {
 	assert.Equal(t, false, d.isCentral())
 	assert.Equal(t, false, d.isEncrypted())
 	assert.Equal(t, true, d.hasMacAddress())
-	assert.Equal(t, true, d.hasCapabilities())
+	assert.Equal(t, true, d.HasCapabilities())
 	assert.Equal(t, true, d.HasMeasurement())
 	assert.Equal(t, false, d.isCustomData())
 	assert.Equal(t, false, d.isSubtitle())
@@ -35,45 +35,51 @@ func TestParse(t *testing.T) {
 		name string
 		data string
 
-		macAddress  []byte
-		measurement func(*testing.T, *model.Measurement)
+		macAddress    []byte
+		measurementID uint16
+		measurement   func(*testing.T, *model.Measurement)
 	}{
 		{
-			name:       "mi-flora temperature",
-			data:       "71209800da795d658d7cc40d0410021201",
-			macAddress: []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			name:          "mi-flora temperature",
+			data:          "71209800da795d658d7cc40d0410021201",
+			macAddress:    []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			measurementID: 0x1004,
 			measurement: func(t *testing.T, m *model.Measurement) {
 				assert.Equal(t, 27.4, m.Temperature.Value())
 			},
 		},
 		{
-			name:       "mi-flora negative temperature",
-			data:       "71209800da795d658d7cc40d041002e7ff",
-			macAddress: []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			name:          "mi-flora negative temperature",
+			data:          "71209800da795d658d7cc40d041002e7ff",
+			macAddress:    []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			measurementID: 0x1004,
 			measurement: func(t *testing.T, m *model.Measurement) {
 				assert.Equal(t, -2.5, m.Temperature.Value())
 			},
 		},
 		{
-			name:       "mi-flora conductivitiy",
-			data:       "71209800d9795d658d7cc40d0910022e00",
-			macAddress: []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			name:          "mi-flora conductivitiy",
+			data:          "71209800d9795d658d7cc40d0910022e00",
+			macAddress:    []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			measurementID: 0x1009,
 			measurement: func(t *testing.T, m *model.Measurement) {
 				assert.Equal(t, 0.0046, m.Conductivity.Value())
 			},
 		},
 		{
-			name:       "mi-flora moisture",
-			data:       "71209800d8795d658d7cc40d0810010d",
-			macAddress: []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			name:          "mi-flora moisture",
+			data:          "71209800d8795d658d7cc40d0810010d",
+			macAddress:    []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			measurementID: 0x1008,
 			measurement: func(t *testing.T, m *model.Measurement) {
 				assert.Equal(t, uint8(13), *m.Moisture)
 			},
 		},
 		{
-			name:       "mi-flora brightness",
-			data:       "71209800ef795d658d7cc40d071003fe4c00",
-			macAddress: []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			name:          "mi-flora brightness",
+			data:          "71209800ef795d658d7cc40d071003fe4c00",
+			macAddress:    []byte{0xc4, 0x7c, 0x8d, 0x65, 0x5d, 0x79},
+			measurementID: 0x1007,
 			measurement: func(t *testing.T, m *model.Measurement) {
 				assert.Equal(t, uint16(0x4cfe), *m.Brightness)
 			},
@@ -87,6 +93,9 @@ func TestParse(t *testing.T) {
 			assert.Equal(t, uint16(0x0098), d.ProductID())
 			assert.Equal(t, tc.macAddress, d.MacAddress())
 			assert.Equal(t, byte(0x0d), d.Capabilities())
+			id, err := d.MeasurementID()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.measurementID, id)
 			m, err := d.Measurement()
 			if tc.measurement != nil {
 				assert.NoError(t, err)
@@ -97,3 +106,34 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	_, err := newFromHex("71209800")
+	assert.ErrorIs(t, err, ErrFrameTooShort)
+
+	// battery measurements are not supported
+	d, err := newFromHex("71209800da795d658d7cc40d0a100162")
+	assert.NoError(t, err)
+	_, err = d.Measurement()
+	var unknownErr *UnknownMeasurementError
+	assert.ErrorAs(t, err, &unknownErr)
+	assert.Equal(t, uint16(0x100a), unknownErr.ID)
+
+	// value is missing
+	d, err = newFromHex("71209800da795d658d7cc40d041002")
+	assert.NoError(t, err)
+	_, err = d.Measurement()
+	assert.ErrorIs(t, err, ErrMeasurementTooShort)
+
+	// object id is missing
+	d, err = newFromHex("71209800da795d658d7cc40d04")
+	assert.NoError(t, err)
+	_, err = d.Measurement()
+	assert.ErrorIs(t, err, ErrMeasurementTooShort)
+
+	// no measurement flag
+	d, err = newFromHex("3120980000")
+	assert.NoError(t, err)
+	_, err = d.Measurement()
+	assert.ErrorIs(t, err, ErrNotMeasurement)
+}
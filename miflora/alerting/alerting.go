@@ -0,0 +1,367 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/state"
+	mprom "github.com/simonswine/mi-flora-exporter/outputs/prometheus"
+)
+
+// Status of a notification.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// States of an alert.
+const (
+	StatePending = "pending"
+	StateFiring  = "firing"
+	// StateError is used for rules, which can't be evaluated for a sensor.
+	StateError = "error"
+)
+
+// notifyTimeout limits the time a single notification can take.
+const notifyTimeout = 30 * time.Second
+
+// Notification is sent when an alert starts firing, is repeated or resolves.
+type Notification struct {
+	Status  string `json:"status"`
+	Rule    string `json:"rule"`
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+
+	Value   float64 `json:"value"`
+	Summary string  `json:"summary"`
+
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+func (n *Notification) sensor() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return n.Address
+}
+
+// Source provides the current state of the sensors.
+type Source interface {
+	Sensors(withHistory bool) []state.Sensor
+}
+
+type alert struct {
+	rule    *Rule
+	name    string
+	address string
+
+	activeSince  time.Time
+	firing       bool
+	lastNotified time.Time
+	value        float64
+	summary      string
+	err          error
+}
+
+func (a *alert) state() string {
+	switch {
+	case a.err != nil:
+		return StateError
+	case a.firing:
+		return StateFiring
+	}
+	return StatePending
+}
+
+func (a *alert) notification(status string) *Notification {
+	return &Notification{
+		Status:   status,
+		Rule:     a.rule.Name,
+		Name:     a.name,
+		Address:  a.address,
+		Value:    a.value,
+		Summary:  a.summary,
+		StartsAt: a.activeSince,
+	}
+}
+
+// Alert is a rule, which is pending, firing or can't be evaluated for a
+// sensor.
+type Alert struct {
+	Rule    string `json:"rule"`
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+	State   string `json:"state"`
+
+	Value   float64 `json:"value"`
+	Summary string  `json:"summary,omitempty"`
+	Error   string  `json:"error,omitempty"`
+
+	ActiveSince *time.Time `json:"active_since,omitempty"`
+}
+
+// Engine evaluates rules against the state of the sensors and sends
+// notifications. It implements prometheus.Collector.
+type Engine struct {
+	logger    log.Logger
+	cfg       *Config
+	notifiers []Notifier
+	now       func() time.Time
+
+	mu     sync.Mutex
+	alerts map[string]*alert
+
+	notifications        *prometheus.CounterVec
+	notificationFailures *prometheus.CounterVec
+	alertsDesc           *prometheus.Desc
+}
+
+func New(cfg *Config) (*Engine, error) {
+	client := &http.Client{Timeout: notifyTimeout}
+	notifiers := make([]Notifier, 0, len(cfg.Notifiers))
+	for _, c := range cfg.Notifiers {
+		n, err := newNotifier(c, client)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	return &Engine{
+		logger:    log.NewNopLogger(),
+		cfg:       cfg,
+		notifiers: notifiers,
+		now:       time.Now,
+		alerts:    make(map[string]*alert),
+		notifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: "alerting",
+			Name:      "notifications_total",
+			Help:      "Total number of notifications sent by notifier and status.",
+		}, []string{"notifier", "status"}),
+		notificationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: "alerting",
+			Name:      "notification_failures_total",
+			Help:      "Total number of notifications which failed to be sent by notifier.",
+		}, []string{"notifier"}),
+		alertsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(mprom.Namespace, "alerting", "alerts"),
+			"Number of pending, firing and errored alerts by rule and state.",
+			[]string{"rule", "state"},
+			nil,
+		),
+	}, nil
+}
+
+func (e *Engine) WithLogger(l log.Logger) *Engine {
+	e.logger = l
+	return e
+}
+
+// check returns whether the rule is active for the sensor, the value and a
+// summary. An error is returned, if the rule can't be evaluated for the
+// sensor.
+func (e *Engine) check(r *Rule, s *state.Sensor, now time.Time) (bool, float64, string, error) {
+	name := s.Name
+	if name == "" {
+		name = s.Address
+	}
+
+	if r.NotSeen > 0 {
+		if s.LastSeen == nil {
+			return false, 0, "", nil
+		}
+		since := now.Sub(*s.LastSeen)
+		return since > r.NotSeen, since.Hours(), fmt.Sprintf("%s has not been seen for %s", name, since.Round(time.Minute)), nil
+	}
+
+	var v float64
+	if r.Value == valueBattery {
+		// advertisements don't contain the battery level, it is only read
+		// by probes
+		if s.Firmware == nil {
+			return false, 0, "", fmt.Errorf("the battery level of %s is unknown, it is only read by probes via /probe", name)
+		}
+		v = float64(s.Firmware.Battery)
+	} else {
+		m, ok := s.Measurements[r.Value]
+		if !ok {
+			return false, 0, "", nil
+		}
+		v = m.Value
+	}
+
+	if r.Below != nil && v < *r.Below {
+		return true, v, fmt.Sprintf("%s of %s is %g, below %g", r.Value, name, v, *r.Below), nil
+	}
+	if r.Above != nil && v > *r.Above {
+		return true, v, fmt.Sprintf("%s of %s is %g, above %g", r.Value, name, v, *r.Above), nil
+	}
+	return false, v, fmt.Sprintf("%s of %s is %g", r.Value, name, v), nil
+}
+
+// evaluate checks all rules and returns the notifications to send.
+func (e *Engine) evaluate(sensors []state.Sensor) []*Notification {
+	now := e.now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var notifications []*Notification
+	for pos := range e.cfg.Rules {
+		r := &e.cfg.Rules[pos]
+		for pos := range sensors {
+			s := &sensors[pos]
+			if !r.matches(s.Name, s.Address) {
+				continue
+			}
+			key := r.Name + "/" + strings.ToLower(s.Address)
+			active, value, summary, err := e.check(r, s, now)
+
+			a, ok := e.alerts[key]
+			if err != nil {
+				if !ok || a.err == nil {
+					_ = level.Warn(e.logger).Log("msg", "rule can't be evaluated", "rule", r.Name, "address", s.Address, "err", err)
+				}
+				e.alerts[key] = &alert{rule: r, name: s.Name, address: s.Address, err: err}
+				continue
+			}
+			if ok && a.err != nil {
+				delete(e.alerts, key)
+				a, ok = nil, false
+			}
+			if !active {
+				if ok {
+					if a.firing {
+						a.value = value
+						a.summary = summary
+						n := a.notification(StatusResolved)
+						n.EndsAt = &now
+						notifications = append(notifications, n)
+					}
+					delete(e.alerts, key)
+				}
+				continue
+			}
+
+			if !ok {
+				a = &alert{rule: r, address: s.Address, activeSince: now}
+				e.alerts[key] = a
+			}
+			a.name = s.Name
+			a.value = value
+			a.summary = summary
+
+			switch {
+			case !a.firing && now.Sub(a.activeSince) >= r.For:
+				a.firing = true
+			case a.firing && e.cfg.RepeatInterval > 0 && now.Sub(a.lastNotified) >= e.cfg.RepeatInterval:
+			default:
+				continue
+			}
+			a.lastNotified = now
+			notifications = append(notifications, a.notification(StatusFiring))
+		}
+	}
+	return notifications
+}
+
+func (e *Engine) notify(ctx context.Context, notifications []*Notification) {
+	for _, n := range notifications {
+		for _, notifier := range e.notifiers {
+			ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+			err := notifier.Notify(ctx, n)
+			cancel()
+			if err != nil {
+				e.notificationFailures.WithLabelValues(notifier.Name()).Inc()
+				_ = level.Error(e.logger).Log("msg", "failed to send notification", "notifier", notifier.Name(), "rule", n.Rule, "address", n.Address, "err", err)
+				continue
+			}
+			e.notifications.WithLabelValues(notifier.Name(), n.Status).Inc()
+			_ = level.Debug(e.logger).Log("msg", "sent notification", "notifier", notifier.Name(), "rule", n.Rule, "address", n.Address, "status", n.Status)
+		}
+	}
+}
+
+// Alerts returns the pending, firing and errored alerts sorted by rule and
+// address.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		alert := Alert{
+			Rule:    a.rule.Name,
+			Name:    a.name,
+			Address: a.address,
+			State:   a.state(),
+			Value:   a.value,
+			Summary: a.summary,
+		}
+		if a.err != nil {
+			alert.Error = a.err.Error()
+		} else {
+			activeSince := a.activeSince
+			alert.ActiveSince = &activeSince
+		}
+		result = append(result, alert)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Rule != result[j].Rule {
+			return result[i].Rule < result[j].Rule
+		}
+		return strings.ToLower(result[i].Address) < strings.ToLower(result[j].Address)
+	})
+	return result
+}
+
+// Run evaluates the rules periodically until the context is canceled.
+func (e *Engine) Run(ctx context.Context, src Source) {
+	ticker := time.NewTicker(e.cfg.EvaluationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.notify(ctx, e.evaluate(src.Sensors(false)))
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (e *Engine) Describe(ch chan<- *prometheus.Desc) {
+	e.notifications.Describe(ch)
+	e.notificationFailures.Describe(ch)
+	ch <- e.alertsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (e *Engine) Collect(ch chan<- prometheus.Metric) {
+	e.notifications.Collect(ch)
+	e.notificationFailures.Collect(ch)
+
+	e.mu.Lock()
+	counts := make(map[[2]string]int)
+	for _, a := range e.alerts {
+		counts[[2]string{a.rule.Name, a.state()}]++
+	}
+	e.mu.Unlock()
+
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(e.alertsDesc, prometheus.GaugeValue, float64(count), k[0], k[1])
+	}
+}
@@ -0,0 +1,160 @@
+package alerting
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	"github.com/simonswine/mi-flora-exporter/miflora/state"
+)
+
+type recorder struct {
+	notifications []*Notification
+}
+
+func (r *recorder) Name() string {
+	return "recorder"
+}
+
+func (r *recorder) Notify(_ context.Context, n *Notification) error {
+	r.notifications = append(r.notifications, n)
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(strings.NewReader(`
+repeat_interval: 1h
+rules:
+- name: dry
+  sensors: [fern]
+  value: moisture
+  below: 15
+  for: 30m
+- name: missing
+  not_seen: 6h
+notifiers:
+- type: ntfy
+  url: https://ntfy.sh/plants
+`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.EvaluationInterval)
+	assert.Equal(t, time.Hour, cfg.RepeatInterval)
+	assert.Equal(t, 30*time.Minute, cfg.Rules[0].For)
+	assert.Equal(t, 6*time.Hour, cfg.Rules[1].NotSeen)
+
+	for _, invalid := range []string{
+		`rules: [{value: moisture, below: 10}]`,
+		`rules: [{name: x, value: humidity, below: 10}]`,
+		`rules: [{name: x, value: moisture}]`,
+		`rules: [{name: x, value: moisture, below: 10, not_seen: 1h}]`,
+		`rules: [{name: x, not_seen: 1h}, {name: x, not_seen: 2h}]`,
+	} {
+		_, err := Load(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+
+	_, err = New(&Config{Notifiers: []NotifierConfig{{Type: "pager"}}})
+	assert.Error(t, err)
+}
+
+func TestEngine(t *testing.T) {
+	below := 15.0
+	e, err := New(&Config{
+		RepeatInterval: time.Hour,
+		Rules: []Rule{
+			{Name: "dry", Sensors: []string{"fern"}, Value: model.FieldMoisture, Below: &below, For: 30 * time.Minute},
+			{Name: "missing", NotSeen: 6 * time.Hour},
+		},
+	})
+	require.NoError(t, err)
+	r := &recorder{}
+	e.notifiers = []Notifier{r}
+
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	sensor := func(moisture float64, lastSeen time.Time) []state.Sensor {
+		return []state.Sensor{{
+			Name:     "fern",
+			Address:  "c4:7c:8d:aa:bb:cc",
+			LastSeen: &lastSeen,
+			Measurements: map[string]state.Value{
+				model.FieldMoisture: {Value: moisture, Timestamp: lastSeen},
+			},
+		}}
+	}
+	step := func(d time.Duration, sensors []state.Sensor) []*Notification {
+		now = now.Add(d)
+		r.notifications = nil
+		e.notify(context.Background(), e.evaluate(sensors))
+		return r.notifications
+	}
+
+	assert.Empty(t, step(0, sensor(20, now)))
+
+	// pending for 30 minutes
+	assert.Empty(t, step(time.Minute, sensor(14, now)))
+	assert.Empty(t, step(20*time.Minute, sensor(13, now)))
+
+	n := step(10*time.Minute, sensor(12, now))
+	require.Len(t, n, 1)
+	assert.Equal(t, StatusFiring, n[0].Status)
+	assert.Equal(t, "dry", n[0].Rule)
+	assert.Equal(t, 12.0, n[0].Value)
+	assert.Equal(t, "moisture of fern is 12, below 15", n[0].Summary)
+
+	// deduplicated until the repeat interval
+	assert.Empty(t, step(30*time.Minute, sensor(12, now)))
+	n = step(30*time.Minute, sensor(12, now))
+	require.Len(t, n, 1)
+	assert.Equal(t, StatusFiring, n[0].Status)
+
+	n = step(time.Minute, sensor(40, now))
+	require.Len(t, n, 1)
+	assert.Equal(t, StatusResolved, n[0].Status)
+	assert.NotNil(t, n[0].EndsAt)
+
+	// sensor goes missing
+	lastSeen := now
+	assert.Empty(t, step(5*time.Hour, sensor(40, lastSeen)))
+	n = step(2*time.Hour, sensor(40, lastSeen))
+	require.Len(t, n, 1)
+	assert.Equal(t, "missing", n[0].Rule)
+	assert.Equal(t, "fern has not been seen for 7h0m0s", n[0].Summary)
+}
+
+func TestEngineBattery(t *testing.T) {
+	below := 10.0
+	e, err := New(&Config{
+		Rules: []Rule{
+			{Name: "battery", Value: valueBattery, Below: &below},
+		},
+	})
+	require.NoError(t, err)
+	r := &recorder{}
+	e.notifiers = []Notifier{r}
+
+	sensors := []state.Sensor{{Name: "fern", Address: "c4:7c:8d:aa:bb:cc"}}
+
+	// without a probe the battery level is unknown
+	assert.Empty(t, e.evaluate(sensors))
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateError, alerts[0].State)
+	assert.Equal(t, "the battery level of fern is unknown, it is only read by probes via /probe", alerts[0].Error)
+
+	// once probed the rule is evaluated
+	sensors[0].Firmware = &state.Firmware{Firmware: model.Firmware{Battery: 5}}
+	n := e.evaluate(sensors)
+	require.Len(t, n, 1)
+	assert.Equal(t, StatusFiring, n[0].Status)
+	alerts = e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Empty(t, alerts[0].Error)
+}
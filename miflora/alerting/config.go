@@ -0,0 +1,145 @@
+package alerting
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// Value used by rules for the battery level.
+const valueBattery = "battery"
+
+// Config contains the rules and the notifiers they are sent to.
+type Config struct {
+	// EvaluationInterval is the interval the rules are evaluated in.
+	EvaluationInterval time.Duration `yaml:"evaluation_interval"`
+	// RepeatInterval is the interval notifications of firing alerts are
+	// repeated in, 0 disables repeating them.
+	RepeatInterval time.Duration `yaml:"repeat_interval"`
+
+	Rules     []Rule           `yaml:"rules"`
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+}
+
+// Rule fires, if a value of a sensor is below or above a threshold or if the
+// sensor has not been seen for a while.
+type Rule struct {
+	Name string `yaml:"name"`
+	// Sensors restricts the rule to sensors with these names or addresses.
+	Sensors []string `yaml:"sensors"`
+
+	// Value is a measurement field or the battery. Thresholds use the units
+	// selected for the exporter. The battery level is only read by probes,
+	// battery rules are in the error state for sensors not probed via
+	// /probe.
+	Value string   `yaml:"value"`
+	Below *float64 `yaml:"below"`
+	Above *float64 `yaml:"above"`
+
+	// NotSeen is the time after which a sensor is considered missing.
+	NotSeen time.Duration `yaml:"not_seen"`
+
+	// For is the time the condition needs to be true before firing.
+	For time.Duration `yaml:"for"`
+}
+
+// NotifierConfig configures a notification channel.
+type NotifierConfig struct {
+	// Type is one of webhook, smtp, ntfy or gotify.
+	Type string `yaml:"type"`
+	// Name is used to identify the notifier in logs and metrics, it defaults
+	// to the type.
+	Name string `yaml:"name"`
+
+	// URL of the webhook, the ntfy topic or the Gotify server.
+	URL string `yaml:"url"`
+	// Token is the Gotify application token or the ntfy access token.
+	Token string `yaml:"token"`
+
+	SmartHost string   `yaml:"smarthost"`
+	From      string   `yaml:"from"`
+	To        []string `yaml:"to"`
+	Username  string   `yaml:"username"`
+	Password  string   `yaml:"password"`
+}
+
+var values = map[string]bool{
+	model.FieldTemperature:  true,
+	model.FieldMoisture:     true,
+	model.FieldBrightness:   true,
+	model.FieldConductivity: true,
+	valueBattery:            true,
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule has no name")
+	}
+	if r.NotSeen > 0 {
+		if r.Value != "" || r.Below != nil || r.Above != nil {
+			return fmt.Errorf("rule '%s' can either check a value or not_seen", r.Name)
+		}
+		return nil
+	}
+	if !values[r.Value] {
+		return fmt.Errorf("rule '%s' has unknown value '%s'", r.Name, r.Value)
+	}
+	if r.Below == nil && r.Above == nil {
+		return fmt.Errorf("rule '%s' needs a below or above threshold", r.Name)
+	}
+	return nil
+}
+
+func (r *Rule) matches(name, address string) bool {
+	if len(r.Sensors) == 0 {
+		return true
+	}
+	for _, s := range r.Sensors {
+		if strings.EqualFold(s, address) || (name != "" && strings.EqualFold(s, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the configuration in YAML format.
+func Load(r io.Reader) (*Config, error) {
+	cfg := &Config{
+		EvaluationInterval: time.Minute,
+		RepeatInterval:     4 * time.Hour,
+	}
+	if err := yaml.NewDecoder(r).Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error decoding alerting config: %w", err)
+	}
+	if cfg.EvaluationInterval <= 0 {
+		return nil, fmt.Errorf("evaluation_interval needs to be positive")
+	}
+
+	names := make(map[string]bool, len(cfg.Rules))
+	for pos := range cfg.Rules {
+		if err := cfg.Rules[pos].validate(); err != nil {
+			return nil, err
+		}
+		if names[cfg.Rules[pos].Name] {
+			return nil, fmt.Errorf("duplicate rule '%s'", cfg.Rules[pos].Name)
+		}
+		names[cfg.Rules[pos].Name] = true
+	}
+	return cfg, nil
+}
+
+// LoadFile reads the configuration from a YAML file.
+func LoadFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,225 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier sends notifications to a channel.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n *Notification) error
+}
+
+func newNotifier(cfg NotifierConfig, client *http.Client) (Notifier, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+
+	switch cfg.Type {
+	case "webhook", "ntfy", "gotify":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("notifier '%s' has no url", name)
+		}
+	case "smtp":
+		if cfg.SmartHost == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("notifier '%s' needs smarthost, from and to", name)
+		}
+		return &smtpNotifier{name: name, cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("notifier '%s' has unknown type '%s'", name, cfg.Type)
+	}
+
+	return &httpNotifier{name: name, cfg: cfg, client: client}, nil
+}
+
+func title(n *Notification) string {
+	return fmt.Sprintf("[%s] %s: %s", strings.ToUpper(n.Status), n.Rule, n.sensor())
+}
+
+// httpNotifier posts notifications to a webhook, ntfy or Gotify.
+type httpNotifier struct {
+	name   string
+	cfg    NotifierConfig
+	client *http.Client
+}
+
+func (h *httpNotifier) Name() string {
+	return h.name
+}
+
+func (h *httpNotifier) request(ctx context.Context, n *Notification) (*http.Request, error) {
+	firing := n.Status == StatusFiring
+
+	switch h.cfg.Type {
+	case "ntfy":
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.URL, strings.NewReader(n.Summary))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Title", title(n))
+		if firing {
+			req.Header.Set("Priority", "high")
+			req.Header.Set("Tags", "warning")
+		} else {
+			req.Header.Set("Tags", "white_check_mark")
+		}
+		if h.cfg.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+h.cfg.Token)
+		}
+		return req, nil
+
+	case "gotify":
+		priority := 2
+		if firing {
+			priority = 8
+		}
+		body, err := json.Marshal(map[string]interface{}{
+			"title":    title(n),
+			"message":  n.Summary,
+			"priority": priority,
+		})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(h.cfg.URL, "/")+"/message", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gotify-Key", h.cfg.Token)
+		return req, nil
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (h *httpNotifier) Notify(ctx context.Context, n *Notification) error {
+	req, err := h.request(ctx, n)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// smtpNotifier sends notifications as email.
+type smtpNotifier struct {
+	name string
+	cfg  NotifierConfig
+}
+
+func (s *smtpNotifier) Name() string {
+	return s.name
+}
+
+func (s *smtpNotifier) message(n *Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	// the title contains the name advertised by the sensor, encoding it
+	// prevents injecting headers
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", title(n)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(&b, "\r\n%s\r\n", n.Summary)
+	return b.Bytes()
+}
+
+func (s *smtpNotifier) Notify(ctx context.Context, n *Notification) (err error) {
+	host, _, err := net.SplitHostPort(s.cfg.SmartHost)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.cfg.SmartHost)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// net/smtp doesn't support contexts, the deadline of the connection
+	// interrupts the exchange once the context is done
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range s.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
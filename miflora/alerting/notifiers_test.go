@@ -0,0 +1,193 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNotification = &Notification{
+	Status:   StatusFiring,
+	Rule:     "dry",
+	Name:     "fern",
+	Address:  "c4:7c:8d:aa:bb:cc",
+	Value:    12,
+	Summary:  "moisture of fern is 12, below 15",
+	StartsAt: time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestHTTPNotifiers(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	t.Run("webhook", func(t *testing.T) {
+		n, err := newNotifier(NotifierConfig{Type: "webhook", URL: srv.URL + "/hook"}, srv.Client())
+		require.NoError(t, err)
+		require.NoError(t, n.Notify(context.Background(), testNotification))
+		assert.Equal(t, "/hook", req.URL.Path)
+
+		var received Notification
+		require.NoError(t, json.Unmarshal(body, &received))
+		assert.Equal(t, *testNotification, received)
+	})
+
+	t.Run("ntfy", func(t *testing.T) {
+		n, err := newNotifier(NotifierConfig{Type: "ntfy", URL: srv.URL + "/plants", Token: "secret"}, srv.Client())
+		require.NoError(t, err)
+		require.NoError(t, n.Notify(context.Background(), testNotification))
+		assert.Equal(t, "/plants", req.URL.Path)
+		assert.Equal(t, "[FIRING] dry: fern", req.Header.Get("Title"))
+		assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+		assert.Equal(t, testNotification.Summary, string(body))
+	})
+
+	t.Run("gotify", func(t *testing.T) {
+		n, err := newNotifier(NotifierConfig{Type: "gotify", URL: srv.URL + "/", Token: "app-token"}, srv.Client())
+		require.NoError(t, err)
+		require.NoError(t, n.Notify(context.Background(), testNotification))
+		assert.Equal(t, "/message", req.URL.Path)
+		assert.Equal(t, "app-token", req.Header.Get("X-Gotify-Key"))
+		assert.JSONEq(t, `{"title":"[FIRING] dry: fern","message":"moisture of fern is 12, below 15","priority":8}`, string(body))
+	})
+}
+
+func TestHTTPNotifierError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	n, err := newNotifier(NotifierConfig{Type: "webhook", URL: srv.URL}, srv.Client())
+	require.NoError(t, err)
+	assert.Error(t, n.Notify(context.Background(), testNotification))
+}
+
+// smtpServer accepts a single mail and returns its recipients and data.
+func smtpServer(t *testing.T) (string, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		var received []string
+		_ = tp.PrintfLine("220 localhost")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO", "MAIL":
+				_ = tp.PrintfLine("250 OK")
+			case "RCPT":
+				received = append(received, line)
+				_ = tp.PrintfLine("250 OK")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				received = append(received, data...)
+				_ = tp.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				ch <- received
+				return
+			default:
+				_ = tp.PrintfLine("502 unknown command")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), ch
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, ch := smtpServer(t)
+
+	n, err := newNotifier(NotifierConfig{
+		Type:      "smtp",
+		SmartHost: addr,
+		From:      "exporter@example.com",
+		To:        []string{"plants@example.com"},
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(context.Background(), testNotification))
+
+	received := <-ch
+	assert.Equal(t, "RCPT TO:<plants@example.com>", received[0])
+	assert.Contains(t, received, "Subject: [FIRING] dry: fern")
+	assert.Contains(t, received, testNotification.Summary)
+}
+
+func TestSMTPNotifierHeaderInjection(t *testing.T) {
+	addr, ch := smtpServer(t)
+
+	n, err := newNotifier(NotifierConfig{
+		Type:      "smtp",
+		SmartHost: addr,
+		From:      "exporter@example.com",
+		To:        []string{"plants@example.com"},
+	}, nil)
+	require.NoError(t, err)
+
+	// the name is advertised by the sensor
+	notification := *testNotification
+	notification.Name = "fern\r\nBcc: attacker@example.com"
+	require.NoError(t, n.Notify(context.Background(), &notification))
+
+	received := <-ch
+	assert.NotContains(t, received, "Bcc: attacker@example.com")
+	assert.Contains(t, received, "Subject: =?UTF-8?q?[FIRING]_dry:_fern=0D=0ABcc:_attacker@example.com?=")
+}
+
+func TestSMTPNotifierCancel(t *testing.T) {
+	// the server accepts connections, but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = ioutil.ReadAll(conn)
+	}()
+
+	n, err := newNotifier(NotifierConfig{
+		Type:      "smtp",
+		SmartHost: ln.Addr().String(),
+		From:      "exporter@example.com",
+		To:        []string{"plants@example.com"},
+	}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	assert.Equal(t, context.Canceled, n.Notify(ctx, testNotification))
+}
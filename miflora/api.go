@@ -0,0 +1,72 @@
+package miflora
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/alerting"
+	"github.com/simonswine/mi-flora-exporter/miflora/state"
+)
+
+const (
+	apiSensorsPath = "/api/v1/sensors"
+	apiAlertsPath  = "/api/v1/alerts"
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type apiSensors struct {
+	Sensors []state.Sensor `json:"sensors"`
+}
+
+type apiAlerts struct {
+	Alerts []alerting.Alert `json:"alerts"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// apiSensorsHandler serves the list of known sensors and single sensors
+// selected by their address. Recent values are included when the history
+// parameter is set.
+func apiSensorsHandler(store *state.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, &apiError{Error: "method not allowed"})
+			return
+		}
+
+		withHistory, _ := strconv.ParseBool(r.URL.Query().Get("history"))
+
+		address := strings.Trim(strings.TrimPrefix(r.URL.Path, apiSensorsPath), "/")
+		if address == "" {
+			writeJSON(w, http.StatusOK, &apiSensors{Sensors: store.Sensors(withHistory)})
+			return
+		}
+
+		sensor, ok := store.Sensor(address, withHistory)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, &apiError{Error: "sensor not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, &sensor)
+	}
+}
+
+// apiAlertsHandler serves the pending, firing and errored alerts.
+func apiAlertsHandler(engine *alerting.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, &apiError{Error: "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, &apiAlerts{Alerts: engine.Alerts()})
+	}
+}
@@ -0,0 +1,57 @@
+package miflora
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/alerting"
+	"github.com/simonswine/mi-flora-exporter/miflora/state"
+)
+
+func TestAPISensorsHandler(t *testing.T) {
+	store := state.New()
+	store.ObserveAdvertisement("c4:7c:8d:aa:bb:cc", "fern", time.Unix(1600000000, 0), -71, 12)
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{path: "/api/v1/sensors", code: http.StatusOK},
+		{path: "/api/v1/sensors/", code: http.StatusOK},
+		{path: "/api/v1/sensors/C4:7C:8D:AA:BB:CC", code: http.StatusOK},
+		{path: "/api/v1/sensors/c4:7c:8d:00:00:00", code: http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		apiSensorsHandler(store)(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if exp, act := tc.code, w.Code; exp != act {
+			t.Errorf("unexpected status code for %s exp: %v, act: %v", tc.path, exp, act)
+		}
+		if exp, act := "application/json", w.Header().Get("Content-Type"); exp != act {
+			t.Errorf("unexpected content type for %s exp: %v, act: %v", tc.path, exp, act)
+		}
+	}
+}
+
+func TestAPIAlertsHandler(t *testing.T) {
+	engine, err := alerting.New(&alerting.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	apiAlertsHandler(engine)(w, httptest.NewRequest(http.MethodGet, apiAlertsPath, nil))
+	if exp, act := http.StatusOK, w.Code; exp != act {
+		t.Errorf("unexpected status code exp: %v, act: %v", exp, act)
+	}
+	if exp, act := "{\"alerts\":[]}\n", w.Body.String(); exp != act {
+		t.Errorf("unexpected body exp: %v, act: %v", exp, act)
+	}
+
+	w = httptest.NewRecorder()
+	apiAlertsHandler(engine)(w, httptest.NewRequest(http.MethodPost, apiAlertsPath, nil))
+	if exp, act := http.StatusMethodNotAllowed, w.Code; exp != act {
+		t.Errorf("unexpected status code exp: %v, act: %v", exp, act)
+	}
+}
@@ -0,0 +1,138 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// BatchConfig configures how many history records are read from a sensor
+// per connection.
+type BatchConfig struct {
+	// Size is the number of records read per connection.
+	Size int
+	// Sizes overrides the size for sensors, keyed by the name or the address
+	// of the sensor.
+	Sizes map[string]int
+
+	// Adaptive grows the size while reads succeed quickly and shrinks it
+	// after timeouts and disconnects, within MinSize and MaxSize.
+	Adaptive bool
+	MinSize  int
+	MaxSize  int
+	// FastRead is the average duration of a read, below which the size is
+	// grown.
+	FastRead time.Duration
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		Size:     50,
+		MinSize:  10,
+		MaxSize:  500,
+		FastRead: 200 * time.Millisecond,
+	}
+}
+
+func (c BatchConfig) validate() []string {
+	var errs []string
+	if c.Size < 1 {
+		errs = append(errs, "history batch size must be at least 1")
+	}
+	for sensor, size := range c.Sizes {
+		if size < 1 {
+			errs = append(errs, fmt.Sprintf("history batch size of sensor '%s' must be at least 1", sensor))
+		}
+	}
+	if c.Adaptive {
+		if c.MinSize < 1 || c.MaxSize < c.MinSize {
+			errs = append(errs, "history batch size limits must be at least 1 with the minimum not above the maximum")
+		}
+		if c.FastRead <= 0 {
+			errs = append(errs, "history batch fast read duration must be positive")
+		}
+	}
+	return errs
+}
+
+// ParseBatchSizes parses sizes of sensors in the format <name|address>=<size>.
+func ParseBatchSizes(values []string) (map[string]int, error) {
+	sizes := make(map[string]int, len(values))
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid batch size '%s', expected <name|address>=<size>", v)
+		}
+		size, err := strconv.Atoi(parts[1])
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid batch size '%s', expected a positive number", v)
+		}
+		sizes[strings.ToLower(parts[0])] = size
+	}
+	return sizes, nil
+}
+
+// size returns the initial batch size of a sensor.
+func (c BatchConfig) size(name, addr string) int {
+	for _, key := range []string{name, addr} {
+		if size, ok := c.Sizes[strings.ToLower(key)]; ok && key != "" {
+			return size
+		}
+	}
+	if c.Size < 1 {
+		return 1
+	}
+	return c.Size
+}
+
+// adapt returns the batch size for the next connection after a connection
+// read the given number of records.
+func (c BatchConfig) adapt(size, records int, elapsed time.Duration, err error) int {
+	if !c.Adaptive {
+		return size
+	}
+
+	var disconnectedErr *disconnectedError
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &disconnectedErr) {
+		size /= 2
+		if size < c.MinSize {
+			size = c.MinSize
+		}
+		return size
+	}
+
+	if err == nil && records >= size && elapsed/time.Duration(records) < c.FastRead {
+		size *= 2
+		if c.MaxSize > 0 && size > c.MaxSize {
+			size = c.MaxSize
+		}
+	}
+	return size
+}
+
+// observeBatch reports the download throughput of a connection and returns
+// the batch size for the next connection to the sensor.
+func (m *MiFlora) observeBatch(s *Sensor, size, records int, elapsed time.Duration, err error) int {
+	addr := s.advertisement.Addr().String()
+	if records > 0 && elapsed > 0 {
+		throughput := float64(records) / elapsed.Seconds()
+		if m.metrics != nil {
+			m.metrics.historyThroughput.WithLabelValues(addr).Set(throughput)
+		}
+		_ = level.Debug(s.logger).Log("msg", "downloaded history batch", "records", records, "duration", elapsed, "records_per_second", fmt.Sprintf("%.2f", throughput))
+	}
+
+	next := m.batch.adapt(size, records, elapsed, err)
+	if next != size {
+		_ = level.Debug(s.logger).Log("msg", "changed history batch size", "from", size, "to", next)
+	}
+	if m.metrics != nil {
+		m.metrics.historyBatchSize.WithLabelValues(addr).Set(float64(next))
+	}
+	return next
+}
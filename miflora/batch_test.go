@@ -0,0 +1,90 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBatchSizes(t *testing.T) {
+	sizes, err := ParseBatchSizes([]string{"my-plant=200", "C4:7C:8D:AA:BB:CC=20"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := DefaultBatchConfig()
+	cfg.Sizes = sizes
+	for _, tc := range []struct {
+		name, addr string
+		exp        int
+	}{
+		{name: "my-plant", addr: "c4:7c:8d:00:00:00", exp: 200},
+		{name: "other", addr: "c4:7c:8d:aa:bb:cc", exp: 20},
+		{name: "", addr: "c4:7c:8d:00:00:00", exp: 50},
+	} {
+		if act := cfg.size(tc.name, tc.addr); tc.exp != act {
+			t.Errorf("unexpected size of %s/%s, exp: %d, act: %d", tc.name, tc.addr, tc.exp, act)
+		}
+	}
+
+	for _, v := range []string{"my-plant", "my-plant=0", "my-plant=many"} {
+		if _, err := ParseBatchSizes([]string{v}); err == nil {
+			t.Errorf("expected error for '%s'", v)
+		}
+	}
+}
+
+func TestBatchConfigAdapt(t *testing.T) {
+	cfg := DefaultBatchConfig()
+	if exp, act := 50, cfg.adapt(50, 50, time.Second, nil); exp != act {
+		t.Errorf("size changed without adaptive mode, exp: %d, act: %d", exp, act)
+	}
+
+	cfg.Adaptive = true
+	for _, tc := range []struct {
+		name    string
+		size    int
+		records int
+		elapsed time.Duration
+		err     error
+		exp     int
+	}{
+		{name: "fast", size: 50, records: 50, elapsed: time.Second, exp: 100},
+		{name: "fast-max", size: 400, records: 400, elapsed: time.Second, exp: 500},
+		{name: "slow", size: 50, records: 50, elapsed: time.Minute, exp: 50},
+		{name: "history-exhausted", size: 50, records: 10, elapsed: time.Second, exp: 50},
+		{name: "timeout", size: 50, records: 20, elapsed: time.Minute, err: context.DeadlineExceeded, exp: 25},
+		{name: "disconnect-min", size: 12, records: 2, elapsed: time.Second, err: &disconnectedError{err: errors.New("closed")}, exp: 10},
+		{name: "other-error", size: 50, records: 20, elapsed: time.Second, err: fmt.Errorf("read: %w", ErrCharacteristicNotFound), exp: 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if act := cfg.adapt(tc.size, tc.records, tc.elapsed, tc.err); tc.exp != act {
+				t.Errorf("unexpected size, exp: %d, act: %d", tc.exp, act)
+			}
+		})
+	}
+}
+
+func TestObserveBatchMetrics(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSensor("c4:7c:8d:aa:bb:cc", -50)
+
+	// the history command serves the metrics with --metrics.listen-address
+	next := m.observeBatch(s, 10, 10, 2*time.Second, nil)
+
+	body := scrapeMetrics(t, m)
+	for _, exp := range []string{
+		`flowercare_exporter_history_download_records_per_second{macaddress="c4:7c:8d:aa:bb:cc"} 5`,
+		fmt.Sprintf(`flowercare_exporter_history_batch_size{macaddress="c4:7c:8d:aa:bb:cc"} %d`, next),
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("metric %s not found in:\n%s", exp, body)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package calibration
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// Mapping corrects a single value. The points are applied first, followed by
+// the scale and the offset. Values use the units of model.Measurement.Values.
+type Mapping struct {
+	Offset float64  `yaml:"offset"`
+	Scale  *float64 `yaml:"scale"`
+	// Points map raw to calibrated values, values between points are
+	// interpolated linearly and values outside are extrapolated using the
+	// nearest segment.
+	Points [][2]float64 `yaml:"points"`
+}
+
+func (m *Mapping) validate() error {
+	if len(m.Points) == 1 {
+		return fmt.Errorf("a piecewise mapping needs at least two points")
+	}
+	for pos := 1; pos < len(m.Points); pos++ {
+		if m.Points[pos][0] <= m.Points[pos-1][0] {
+			return fmt.Errorf("points need to be strictly increasing")
+		}
+	}
+	return nil
+}
+
+// Apply returns the calibrated value.
+func (m *Mapping) Apply(v float64) float64 {
+	if len(m.Points) >= 2 {
+		pos := sort.Search(len(m.Points), func(i int) bool {
+			return m.Points[i][0] > v
+		})
+		if pos == 0 {
+			pos = 1
+		} else if pos == len(m.Points) {
+			pos = len(m.Points) - 1
+		}
+		a, b := m.Points[pos-1], m.Points[pos]
+		v = a[1] + (v-a[0])*(b[1]-a[1])/(b[0]-a[0])
+	}
+	if m.Scale != nil {
+		v *= *m.Scale
+	}
+	return v + m.Offset
+}
+
+// Sensor contains the mappings of a sensor.
+type Sensor struct {
+	// Sensor is the name or address of the sensor.
+	Sensor string `yaml:"sensor"`
+
+	Temperature  *Mapping `yaml:"temperature"`
+	Moisture     *Mapping `yaml:"moisture"`
+	Brightness   *Mapping `yaml:"brightness"`
+	Conductivity *Mapping `yaml:"conductivity"`
+}
+
+func (s *Sensor) mappings() map[string]*Mapping {
+	mappings := make(map[string]*Mapping, 4)
+	if s.Temperature != nil {
+		mappings[model.FieldTemperature] = s.Temperature
+	}
+	if s.Moisture != nil {
+		mappings[model.FieldMoisture] = s.Moisture
+	}
+	if s.Brightness != nil {
+		mappings[model.FieldBrightness] = s.Brightness
+	}
+	if s.Conductivity != nil {
+		mappings[model.FieldConductivity] = s.Conductivity
+	}
+	return mappings
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, math.Round(v)))
+}
+
+// Apply returns a calibrated copy of the measurement.
+func (s *Sensor) Apply(m *model.Measurement) *model.Measurement {
+	c := *m
+	if m.Temperature != nil && s.Temperature != nil {
+		v := model.Temperature(clamp(s.Temperature.Apply(m.Temperature.Value())*10, math.MinInt16, math.MaxInt16))
+		c.Temperature = &v
+	}
+	if m.Moisture != nil && s.Moisture != nil {
+		v := uint8(clamp(s.Moisture.Apply(float64(*m.Moisture)), 0, math.MaxUint8))
+		c.Moisture = &v
+	}
+	if m.Brightness != nil && s.Brightness != nil {
+		v := uint16(clamp(s.Brightness.Apply(float64(*m.Brightness)), 0, math.MaxUint16))
+		c.Brightness = &v
+	}
+	if m.Conductivity != nil && s.Conductivity != nil {
+		v := model.Conductivity(clamp(s.Conductivity.Apply(m.Conductivity.Value())*10000, 0, math.MaxUint16))
+		c.Conductivity = &v
+	}
+	return &c
+}
+
+func key(sensor string) string {
+	return strings.ToLower(strings.TrimSpace(sensor))
+}
+
+// Calibrator applies the calibration of sensors to their measurements. It
+// should be the first processor, so all later processors and outputs observe
+// calibrated values. It implements pipeline.Processor.
+type Calibrator struct {
+	sensors map[string]*Sensor
+	keepRaw bool
+}
+
+// New returns a calibrator without any calibrations.
+func New() *Calibrator {
+	return &Calibrator{sensors: make(map[string]*Sensor)}
+}
+
+// WithKeepRaw keeps the uncalibrated measurement in the results.
+func (c *Calibrator) WithKeepRaw(keepRaw bool) *Calibrator {
+	c.keepRaw = keepRaw
+	return c
+}
+
+// Load reads calibrations in YAML format. Calibrations for sensors already
+// known are replaced.
+func (c *Calibrator) Load(r io.Reader) error {
+	var sensors []*Sensor
+	if err := yaml.NewDecoder(r).Decode(&sensors); err != nil && err != io.EOF {
+		return fmt.Errorf("error decoding calibrations: %w", err)
+	}
+
+	for pos, s := range sensors {
+		if key(s.Sensor) == "" {
+			return fmt.Errorf("calibration %d has no sensor", pos)
+		}
+		for field, m := range s.mappings() {
+			if err := m.validate(); err != nil {
+				return fmt.Errorf("calibration of '%s' for %s is invalid: %w", s.Sensor, field, err)
+			}
+		}
+		c.sensors[key(s.Sensor)] = s
+	}
+	return nil
+}
+
+// LoadFile reads calibrations from a YAML file.
+func (c *Calibrator) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Load(f)
+}
+
+// Sensor returns the calibration of the sensor, it is looked up by address
+// first and then by name.
+func (c *Calibrator) Sensor(address, name string) (*Sensor, bool) {
+	if s, ok := c.sensors[key(address)]; ok {
+		return s, true
+	}
+	if name == "" {
+		return nil, false
+	}
+	s, ok := c.sensors[key(name)]
+	return s, ok
+}
+
+// Process implements pipeline.Processor.
+func (c *Calibrator) Process(r *model.Result) []*model.Result {
+	if r.Measurement == nil {
+		return []*model.Result{r}
+	}
+	s, ok := c.Sensor(r.Address, r.Name)
+	if !ok {
+		return []*model.Result{r}
+	}
+
+	if c.keepRaw {
+		r.RawMeasurement = r.Measurement
+	}
+	r.Measurement = s.Apply(r.Measurement)
+	return []*model.Result{r}
+}
@@ -0,0 +1,78 @@
+package calibration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func TestMapping(t *testing.T) {
+	scale := 2.0
+	for _, tc := range []struct {
+		name    string
+		mapping Mapping
+		in, out float64
+	}{
+		{name: "offset", mapping: Mapping{Offset: -8}, in: 30, out: 22},
+		{name: "scale and offset", mapping: Mapping{Scale: &scale, Offset: 1}, in: 10, out: 21},
+		{name: "piecewise", mapping: Mapping{Points: [][2]float64{{0, 0}, {10, 20}, {20, 25}}}, in: 15, out: 22.5},
+		{name: "piecewise below", mapping: Mapping{Points: [][2]float64{{0, 0}, {10, 20}, {20, 25}}}, in: -1, out: -2},
+		{name: "piecewise above", mapping: Mapping{Points: [][2]float64{{0, 0}, {10, 20}, {20, 25}}}, in: 30, out: 30},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.out, tc.mapping.Apply(tc.in), 1e-9)
+		})
+	}
+}
+
+func TestCalibrator(t *testing.T) {
+	c := New().WithKeepRaw(true)
+	require.NoError(t, c.Load(strings.NewReader(`
+- sensor: fern
+  moisture: {offset: -8}
+  temperature: {offset: -1.5}
+- sensor: C4:7C:8D:AA:BB:DD
+  brightness:
+    points: [[0, 0], [1000, 2000]]
+`)))
+
+	temperature := model.Temperature(215)
+	moisture := uint8(5)
+	brightness := uint16(100)
+	raw := &model.Measurement{
+		Temperature: &temperature,
+		Moisture:    &moisture,
+		Brightness:  &brightness,
+	}
+
+	results := c.Process(&model.Result{Name: "fern", Address: "c4:7c:8d:aa:bb:cc", Measurement: raw})
+	require.Len(t, results, 1)
+	m := results[0].Measurement
+	assert.Equal(t, model.Temperature(200), *m.Temperature)
+	assert.Equal(t, uint8(0), *m.Moisture, "clamped to the range of the field")
+	assert.Equal(t, uint16(100), *m.Brightness)
+	assert.Same(t, raw, results[0].RawMeasurement)
+	assert.Equal(t, uint8(5), *raw.Moisture, "raw measurement is unchanged")
+
+	results = c.Process(&model.Result{Address: "c4:7c:8d:aa:bb:dd", Measurement: raw})
+	assert.Equal(t, uint16(200), *results[0].Measurement.Brightness)
+
+	r := &model.Result{Address: "c4:7c:8d:aa:bb:ee", Measurement: raw}
+	results = c.Process(r)
+	assert.Same(t, raw, results[0].Measurement)
+	assert.Nil(t, results[0].RawMeasurement)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, invalid := range []string{
+		`- moisture: {offset: 1}`,
+		`- {sensor: fern, moisture: {points: [[0, 0]]}}`,
+		`- {sensor: fern, moisture: {points: [[10, 0], [0, 10]]}}`,
+	} {
+		assert.Error(t, New().Load(strings.NewReader(invalid)), invalid)
+	}
+}
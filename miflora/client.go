@@ -2,20 +2,71 @@ package miflora
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"time"
 
 	"github.com/go-ble/ble"
+	"github.com/go-kit/kit/log"
 	"github.com/simonswine/mi-flora-exporter/miflora/model"
 )
 
-type client struct {
+// Client is a connection to a single sensor. It is returned by
+// MiFlora.Connect and has to be closed after use.
+type Client struct {
 	client  ble.Client
 	profile *ble.Profile
+	metrics *metrics
+	logger  log.Logger
+	retry   RetryPolicy
 }
 
-func (c *client) findCharacteristicByValueHandle(handle uint16) *ble.Characteristic {
+// do runs an operation on the sensor according to the retry policy. Once
+// the connection is closed, errors are no longer retried.
+func (c *Client) do(ctx context.Context, operation string, f func() error) error {
+	return c.retry.do(ctx, c.logger, c.metrics, operation, func() error {
+		err := f()
+		if err != nil && c.disconnected() {
+			return &disconnectedError{err: err}
+		}
+		return err
+	})
+}
+
+func (c *Client) disconnected() bool {
+	select {
+	case <-c.Disconnected():
+		return true
+	default:
+		return false
+	}
+}
+
+// observe starts timing a GATT operation, calling the returned function
+// records the operation and its outcome.
+func (c *Client) observe(operation string) func(*error) {
+	start := time.Now()
+	return func(err *error) {
+		c.metrics.observeGATT(operation, start, *err)
+		if *err != nil {
+			*err = &OperationError{Op: operation, Err: *err}
+		}
+	}
+}
+
+// Close disconnects from the sensor.
+func (c *Client) Close() error {
+	return c.client.CancelConnection()
+}
+
+// Disconnected returns a channel, which is closed once the connection to the
+// sensor is closed.
+func (c *Client) Disconnected() <-chan struct{} {
+	return c.client.Disconnected()
+}
+
+func (c *Client) findCharacteristicByValueHandle(handle uint16) *ble.Characteristic {
 	for _, s := range c.profile.Services {
 		for _, c := range s.Characteristics {
 			if c.ValueHandle == handle {
@@ -26,41 +77,61 @@ func (c *client) findCharacteristicByValueHandle(handle uint16) *ble.Characteris
 	return nil
 }
 
-func (c *client) read(handle uint16) ([]byte, error) {
+func (c *Client) read(handle uint16) ([]byte, error) {
 	char := c.findCharacteristicByValueHandle(handle)
 	if char == nil {
-		return nil, fmt.Errorf("error couldn't find characteristic with ValueHandle 0x%x", handle)
+		return nil, fmt.Errorf("error couldn't find ValueHandle 0x%x: %w", handle, ErrCharacteristicNotFound)
 	}
 
 	return c.client.ReadCharacteristic(char)
 }
 
-func (c *client) write(handle uint16, data []byte) error {
+func (c *Client) write(handle uint16, data []byte) error {
 	char := c.findCharacteristicByValueHandle(handle)
 	if char == nil {
-		return fmt.Errorf("error couldn't find characteristic with ValueHandle 0x%x", handle)
+		return fmt.Errorf("error couldn't find ValueHandle 0x%x: %w", handle, ErrCharacteristicNotFound)
 	}
 
 	return c.client.WriteCharacteristic(char, data, false)
 }
 
-func (c *client) DeviceTimeDiff() (time.Duration, error) {
+// DeviceTime reads the seconds since the sensor booted and relates them to
+// the wall time.
+func (c *Client) DeviceTime() (_ DeviceTime, err error) {
+	defer c.observe(opDeviceTime)(&err)
+
 	start := time.Now().UTC()
 	data, err := c.read(handleDeviceTime)
 	if err != nil {
-		return 0, err
+		return DeviceTime{}, err
 	}
 	duration := time.Now().UTC().Sub(start)
 
 	var t int32
 	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &t); err != nil {
-		return 0, fmt.Errorf("error reading timestamp: %w", err)
+		return DeviceTime{}, fmt.Errorf("%w: error reading timestamp: %v", ErrInvalidData, err)
 	}
 
-	return start.Add(duration / 2).Sub(time.Unix(int64(t), 0)), nil
+	return DeviceTime{
+		Time:   start.Add(duration / 2),
+		Device: int64(t),
+	}, nil
 }
 
-func (c *client) Firmware() (*model.Firmware, error) {
+// DeviceTimeDiff returns the offset between the wall time and the device
+// time.
+func (c *Client) DeviceTimeDiff() (time.Duration, error) {
+	o, err := c.DeviceTime()
+	if err != nil {
+		return 0, err
+	}
+	return o.Time.Sub(time.Unix(o.Device, 0)), nil
+}
+
+// Firmware reads the firmware version and the battery level.
+func (c *Client) Firmware() (_ *model.Firmware, err error) {
+	defer c.observe(opFirmware)(&err)
+
 	data, err := c.read(handleFirmwareBattery)
 	if err != nil {
 		return nil, err
@@ -68,13 +139,16 @@ func (c *client) Firmware() (*model.Firmware, error) {
 
 	firmware := &model.Firmware{}
 	if err := firmware.UnmarshalBinary(data); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
 	}
 
 	return firmware, nil
 }
 
-func (c *client) Measurement() (*model.Measurement, error) {
+// Measurement reads the current measurement.
+func (c *Client) Measurement() (_ *model.Measurement, err error) {
+	defer c.observe(opMeasurement)(&err)
+
 	if err := c.write(handleModeChange, modeRealtimeReadInit); err != nil {
 		return nil, err
 	}
@@ -86,13 +160,16 @@ func (c *client) Measurement() (*model.Measurement, error) {
 
 	measurement := &model.Measurement{}
 	if err := measurement.UnmarshalBinary(bytes.NewReader(data)); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
 	}
 
 	return measurement, nil
 }
 
-func (c *client) HistoryLength() (uint16, error) {
+// HistoryLength reads the number of records in the history of the sensor.
+func (c *Client) HistoryLength() (_ uint16, err error) {
+	defer c.observe(opHistoryLength)(&err)
+
 	if err := c.write(handleHistoryControl, modeHistoryReadInit); err != nil {
 		return 0, err
 	}
@@ -104,7 +181,7 @@ func (c *client) HistoryLength() (uint16, error) {
 
 	var historyLength uint16
 	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &historyLength); err != nil {
-		return 0, fmt.Errorf("error can't read history length: %w", err)
+		return 0, fmt.Errorf("%w: error can't read history length: %v", ErrInvalidData, err)
 	}
 
 	return historyLength, nil
@@ -116,7 +193,12 @@ func historyAddress(pos uint16) []byte {
 	binary.LittleEndian.PutUint16(b[1:], pos)
 	return b
 }
-func (c *client) HistoryMeasurement(pos uint16) (*HistoricMeasurement, error) {
+
+// HistoryMeasurement reads the history record at the given position,
+// HistoryLength has to be read before.
+func (c *Client) HistoryMeasurement(pos uint16) (_ *HistoricMeasurement, err error) {
+	defer c.observe(opHistoryMeasurement)(&err)
+
 	if err := c.write(handleHistoryControl, historyAddress(pos)); err != nil {
 		return nil, err
 	}
@@ -128,8 +210,26 @@ func (c *client) HistoryMeasurement(pos uint16) (*HistoricMeasurement, error) {
 
 	measurement := &HistoricMeasurement{}
 	if err := measurement.UnmarshalBinary(bytes.NewReader(data)); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
 	}
 
 	return measurement, nil
 }
+
+// BlinkLED lets the LED of the sensor blink, to identify it.
+func (c *Client) BlinkLED() (err error) {
+	defer c.observe(opBlinkLED)(&err)
+
+	return c.write(handleModeChange, modeBlinkLED)
+}
+
+// ClearHistory deletes all records from the history of the sensor.
+func (c *Client) ClearHistory() (err error) {
+	defer c.observe(opClearHistory)(&err)
+
+	if err := c.write(handleHistoryControl, modeHistoryReadInit); err != nil {
+		return err
+	}
+	// confirming a successful read of the history clears it
+	return c.write(handleHistoryControl, modeHistoryReadSuccess)
+}
@@ -0,0 +1,215 @@
+package miflora
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-ble/ble"
+	"github.com/go-kit/kit/log"
+)
+
+// fakeBLEClient emulates the GATT characteristics of a sensor with the given
+// history, using the position as device time.
+type fakeBLEClient struct {
+	ble.Client
+
+	history      []int64
+	historyRead  []byte
+	writes       [][]byte
+	disconnected chan struct{}
+	readErr      error
+}
+
+func newFakeBLEClient(history ...int64) *fakeBLEClient {
+	return &fakeBLEClient{history: history, disconnected: make(chan struct{})}
+}
+
+func (f *fakeBLEClient) ReadCharacteristic(c *ble.Characteristic) ([]byte, error) {
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+	switch c.ValueHandle {
+	case handleFirmwareBattery:
+		return []byte{0x64}, nil
+	case handleHistoryRead:
+		return f.historyRead, nil
+	}
+	return nil, fmt.Errorf("unexpected read of 0x%x", c.ValueHandle)
+}
+
+func (f *fakeBLEClient) WriteCharacteristic(c *ble.Characteristic, data []byte, _ bool) error {
+	f.writes = append(f.writes, append([]byte{byte(c.ValueHandle)}, data...))
+	if c.ValueHandle != handleHistoryControl {
+		return nil
+	}
+
+	var b bytes.Buffer
+	switch {
+	case bytes.Equal(data, modeHistoryReadInit):
+		_ = binary.Write(&b, binary.LittleEndian, uint16(len(f.history)))
+		b.Write(make([]byte, 14))
+	case data[0] == 0xa1:
+		pos := binary.LittleEndian.Uint16(data[1:])
+		_ = binary.Write(&b, binary.LittleEndian, int32(f.history[pos]))
+		b.Write([]byte{0xd7, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x2a, 0x64, 0x00, 0, 0, 0, 0, 0, 0})
+	}
+	f.historyRead = b.Bytes()
+	return nil
+}
+
+func (f *fakeBLEClient) Disconnected() <-chan struct{} {
+	return f.disconnected
+}
+
+func newFakeClient(f *fakeBLEClient) *Client {
+	var characteristics []*ble.Characteristic
+	for _, h := range []uint16{handleFirmwareBattery, handleModeChange, handleHistoryControl, handleHistoryRead} {
+		characteristics = append(characteristics, &ble.Characteristic{ValueHandle: h})
+	}
+	return &Client{
+		client:  f,
+		profile: &ble.Profile{Services: []*ble.Service{{Characteristics: characteristics}}},
+		logger:  log.NewNopLogger(),
+		retry:   RetryPolicy{Attempts: 3},
+	}
+}
+
+func TestClientHistory(t *testing.T) {
+	c := newFakeClient(newFakeBLEClient(100, 200, 300))
+
+	var positions, deviceTimes []int64
+	it := c.History(context.Background(), Cursor{})
+	for it.Next() {
+		positions = append(positions, int64(it.Cursor().Index))
+		deviceTimes = append(deviceTimes, it.Measurement().DeviceTime.Unix())
+		if exp, act := uint8(42), *it.Measurement().Moisture; exp != act {
+			t.Errorf("unexpected moisture, exp: %d, act: %d", exp, act)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, act := fmt.Sprint([]int64{2, 1, 0}), fmt.Sprint(positions); exp != act {
+		t.Errorf("unexpected positions, exp: %s, act: %s", exp, act)
+	}
+	if exp, act := fmt.Sprint([]int64{300, 200, 100}), fmt.Sprint(deviceTimes); exp != act {
+		t.Errorf("unexpected device times, exp: %s, act: %s", exp, act)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it = c.History(ctx, Cursor{})
+	if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+		t.Errorf("unexpected iteration after cancel: %v", it.Err())
+	}
+}
+
+func TestClientHistoryResume(t *testing.T) {
+	f := newFakeBLEClient(100, 200, 300, 400)
+	c := newFakeClient(f)
+
+	it := c.History(context.Background(), Cursor{})
+	if !it.Next() || !it.Next() {
+		t.Fatalf("unexpected error: %v", it.Err())
+	}
+	data, err := json.Marshal(it.Cursor())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := uint16(2), cursor.Index; exp != act {
+		t.Errorf("unexpected cursor index, exp: %d, act: %d", exp, act)
+	}
+
+	// records appended since don't change the positions of older records
+	f.history = append(f.history, 500)
+	var deviceTimes []int64
+	it = c.History(context.Background(), cursor)
+	for it.Next() {
+		deviceTimes = append(deviceTimes, it.Measurement().DeviceTime.Unix())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, act := fmt.Sprint([]int64{200, 100}), fmt.Sprint(deviceTimes); exp != act {
+		t.Errorf("unexpected device times, exp: %s, act: %s", exp, act)
+	}
+	if !it.Cursor().Done() {
+		t.Errorf("expected cursor to be done: %+v", it.Cursor())
+	}
+
+	// the history has been replaced
+	f.history = []int64{1000, 2000, 3000, 4000}
+	it = c.History(context.Background(), cursor)
+	if it.Next() || !errors.Is(it.Err(), ErrHistoryChanged) {
+		t.Errorf("expected history changed error, act: %v", it.Err())
+	}
+}
+
+func TestClientCommands(t *testing.T) {
+	f := newFakeBLEClient()
+	c := newFakeClient(f)
+
+	if err := c.BlinkLED(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.ClearHistory(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exp := [][]byte{
+		{0x33, 0xfd, 0xff},
+		{0x3e, 0xa0, 0x00, 0x00},
+		{0x3e, 0xa2, 0x00, 0x00},
+	}
+	if fmt.Sprintf("%x", exp) != fmt.Sprintf("%x", f.writes) {
+		t.Errorf("unexpected writes, exp: %x, act: %x", exp, f.writes)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	f := newFakeBLEClient()
+	c := newFakeClient(f)
+
+	// firmware data is too short
+	_, err := c.Firmware()
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.Op != opFirmware {
+		t.Errorf("expected operation error, act: %v", err)
+	}
+	if !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected invalid data error, act: %v", err)
+	}
+
+	// the device time characteristic is missing
+	if _, err := c.DeviceTime(); !errors.Is(err, ErrCharacteristicNotFound) {
+		t.Errorf("expected characteristic not found error, act: %v", err)
+	}
+
+	// failed reads are retried, until the sensor disconnects
+	f.readErr = errors.New("req timeout")
+	var attempts int
+	err = c.do(context.Background(), opFirmware, func() error {
+		attempts++
+		if attempts == 2 {
+			close(f.disconnected)
+		}
+		_, err := c.Firmware()
+		return err
+	})
+	if !errors.Is(err, ErrDisconnected) {
+		t.Errorf("expected disconnected error, act: %v", err)
+	}
+	if exp, act := 2, attempts; exp != act {
+		t.Errorf("unexpected attempts, exp: %d, act: %d", exp, act)
+	}
+}
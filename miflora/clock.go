@@ -0,0 +1,218 @@
+package miflora
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	// maxClockObservations limits the observations kept per sensor
+	maxClockObservations = 100
+	// clockObservationInterval is the minimum time between observations
+	// kept to estimate the drift
+	clockObservationInterval = 10 * time.Minute
+	// minClockSpan is the minimum time covered by observations to estimate
+	// the drift
+	minClockSpan = 12 * time.Hour
+	// maxClockDrift limits the drift to plausible values, larger estimates
+	// are ignored
+	maxClockDrift = 0.01
+
+	secondsPerDay = 24 * 60 * 60
+)
+
+// DeviceTime relates the device time, which are the seconds since the
+// sensor booted, to the wall time.
+type DeviceTime struct {
+	Time   time.Time `json:"time"`
+	Device int64     `json:"device"`
+}
+
+// Uptime returns the time since the sensor booted.
+func (t DeviceTime) Uptime() time.Duration {
+	return time.Duration(t.Device) * time.Second
+}
+
+type clockState struct {
+	// Latest is the most recent observation
+	Latest *DeviceTime `json:"latest,omitempty"`
+	// Observations are used to estimate the drift
+	Observations []DeviceTime `json:"observations"`
+}
+
+// ClockTracker records the device time of sensors over time, to estimate
+// the drift of their clocks. The observations are persisted in a JSON file,
+// if a path is given.
+type ClockTracker struct {
+	mu      sync.Mutex
+	path    string
+	sensors map[string]*clockState
+}
+
+// NewClockTracker loads the observations from the file at path. An empty
+// path keeps observations in memory only.
+func NewClockTracker(path string) (*ClockTracker, error) {
+	t := &ClockTracker{
+		path:    path,
+		sensors: make(map[string]*clockState),
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &t.sensors); err != nil {
+		return nil, fmt.Errorf("error parsing clock state %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Save writes the observations to the file.
+func (t *ClockTracker) Save() error {
+	if t == nil || t.path == "" {
+		return nil
+	}
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.sensors, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(t.path), filepath.Base(t.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), t.path)
+}
+
+func (t *ClockTracker) state(addr string) *clockState {
+	addr = strings.ToLower(addr)
+	s, ok := t.sensors[addr]
+	if !ok {
+		s = &clockState{}
+		t.sensors[addr] = s
+	}
+	return s
+}
+
+// observe records a device time of the sensor. The observations are reset
+// once the device time goes backwards, as the sensor has been rebooted.
+func (t *ClockTracker) observe(addr string, o DeviceTime) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.state(addr)
+	if s.Latest != nil && o.Device < s.Latest.Device {
+		s.Observations = nil
+	}
+	s.Latest = &o
+
+	if n := len(s.Observations); n > 0 && o.Time.Sub(s.Observations[n-1].Time) < clockObservationInterval {
+		return
+	}
+	s.Observations = append(s.Observations, o)
+	if len(s.Observations) > maxClockObservations {
+		s.Observations = s.Observations[len(s.Observations)-maxClockObservations:]
+	}
+}
+
+// Drift estimates the drift of the sensor clock, as the seconds the sensor
+// clock gains per second of wall time.
+func (t *ClockTracker) Drift(addr string) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.drift(t.state(addr).Observations)
+}
+
+func (t *ClockTracker) drift(obs []DeviceTime) (float64, bool) {
+	if len(obs) < 2 || obs[len(obs)-1].Time.Sub(obs[0].Time) < minClockSpan {
+		return 0, false
+	}
+
+	// least squares fit of the device time over the wall time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, o := range obs {
+		x := o.Time.Sub(obs[0].Time).Seconds()
+		y := float64(o.Device - obs[0].Device)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(obs))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+
+	drift := (n*sumXY-sumX*sumY)/denominator - 1
+	if math.Abs(drift) > maxClockDrift {
+		return 0, false
+	}
+	return drift, true
+}
+
+// WallTime maps a device time of the sensor to the wall time, based on the
+// latest observation corrected by the estimated drift.
+func (t *ClockTracker) WallTime(addr string, device int64) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.state(addr)
+	if s.Latest == nil {
+		return time.Time{}, false
+	}
+	latest := *s.Latest
+
+	drift, _ := t.drift(s.Observations)
+	elapsed := float64(latest.Device-device) / (1 + drift)
+	return latest.Time.Add(-time.Duration(elapsed * float64(time.Second))), true
+}
+
+// observeClock records the device time of the sensor and reports the
+// estimated drift and the uptime of the sensor.
+func (m *MiFlora) observeClock(logger log.Logger, addr string, o DeviceTime) {
+	m.clock.observe(addr, o)
+
+	drift, ok := m.clock.Drift(addr)
+	if ok {
+		_ = level.Debug(logger).Log("msg", "estimated clock drift", "drift", drift, "seconds_per_day", fmt.Sprintf("%.1f", drift*secondsPerDay))
+	}
+	if m.metrics == nil {
+		return
+	}
+	m.metrics.uptime.WithLabelValues(addr).Set(float64(o.Device))
+	if ok {
+		m.metrics.clockDrift.WithLabelValues(addr).Set(drift)
+	}
+}
+
+func (m *MiFlora) saveClock() {
+	if err := m.clock.Save(); err != nil {
+		_ = level.Warn(m.logger).Log("msg", "error saving clock state", "error", err)
+	}
+}
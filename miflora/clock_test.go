@@ -0,0 +1,120 @@
+package miflora
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// observeDrifting records observations of a sensor clock, which gains the
+// given drift.
+func observeDrifting(t *ClockTracker, addr string, start time.Time, boot int64, drift float64, span, interval time.Duration) {
+	for elapsed := time.Duration(0); elapsed <= span; elapsed += interval {
+		t.observe(addr, DeviceTime{
+			Time:   start.Add(elapsed),
+			Device: boot + int64(math.Round(elapsed.Seconds()*(1+drift))),
+		})
+	}
+}
+
+func TestClockTrackerDrift(t *testing.T) {
+	tracker, err := NewClockTracker("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// 5 minutes per week
+	drift := 300.0 / (7 * secondsPerDay)
+	observeDrifting(tracker, "AA", start, 1000, drift, 6*time.Hour, time.Hour)
+	if _, ok := tracker.Drift("aa"); ok {
+		t.Error("drift estimated from too short span")
+	}
+
+	observeDrifting(tracker, "AA", start.Add(7*time.Hour), 1000+int64(7*3600*(1+drift)), drift, 7*24*time.Hour, time.Hour)
+	act, ok := tracker.Drift("aa")
+	if !ok {
+		t.Fatal("drift not estimated")
+	}
+	if math.Abs(act-drift) > 1e-6 {
+		t.Errorf("unexpected drift, exp: %g, act: %g", drift, act)
+	}
+
+	// a record from a week ago is corrected by the drift
+	latest := tracker.sensors["aa"].Latest
+	device := latest.Device - int64(7*secondsPerDay*(1+drift))
+	wall, ok := tracker.WallTime("aa", device)
+	if !ok {
+		t.Fatal("no wall time")
+	}
+	if exp, act := latest.Time.Add(-7*24*time.Hour), wall; act.Sub(exp) > 2*time.Second || exp.Sub(act) > 2*time.Second {
+		t.Errorf("unexpected wall time, exp: %s, act: %s", exp, act)
+	}
+
+	// a reboot resets the observations
+	tracker.observe("aa", DeviceTime{Time: latest.Time.Add(time.Hour), Device: 10})
+	if _, ok := tracker.Drift("aa"); ok {
+		t.Error("drift estimated after reboot")
+	}
+	if wall, _ := tracker.WallTime("aa", 0); !wall.Equal(latest.Time.Add(time.Hour - 10*time.Second)) {
+		t.Errorf("unexpected wall time after reboot: %s", wall)
+	}
+}
+
+func TestClockTrackerSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flowercare-clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "clock.json")
+
+	tracker, err := NewClockTracker(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	observeDrifting(tracker, "aa", start, 0, 0.001, 24*time.Hour, time.Hour)
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := NewClockTracker(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp, _ := tracker.Drift("aa")
+	act, ok := loaded.Drift("aa")
+	if !ok || exp != act {
+		t.Errorf("unexpected drift after loading, exp: %g, act: %g", exp, act)
+	}
+}
+
+func TestObserveClockMetrics(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const addr = "c4:7c:8d:aa:bb:cc"
+	start := time.Unix(1600000000, 0)
+	observeDrifting(m.clock, addr, start, 1000, 0, 24*time.Hour, time.Hour)
+
+	// probes and sessions observe the clock the same way
+	m.observeClock(log.NewNopLogger(), addr, DeviceTime{Time: start.Add(25 * time.Hour), Device: 1000 + 25*3600})
+
+	body := scrapeMetrics(t, m)
+	for _, exp := range []string{
+		`flowercare_exporter_sensor_uptime_seconds{macaddress="c4:7c:8d:aa:bb:cc"} 91000`,
+		`flowercare_exporter_sensor_clock_drift_ratio{macaddress="c4:7c:8d:aa:bb:cc"} 0`,
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("metric %s not found in:\n%s", exp, body)
+		}
+	}
+}
@@ -1,3 +1,6 @@
+// Package context provides the context values, which configured MiFlora
+// before the options of miflora.New. It is kept as a compatibility layer,
+// values set in the context override the options.
 package context
 
 import (
@@ -16,94 +19,243 @@ const (
 	contextSensorNames
 	contextResultChannel
 	contextBindAddress
+	contextMetricsTimestamps
+	contextReadyWindow
+	contextUnits
+	contextConcurrency
+	contextSensorTimeout
+	contextHistorySince
+	contextHistoryUntil
+	contextHistoryMaxRecords
 )
 
-func ContextWithScanTimeout(ctx context.Context, t time.Duration) context.Context {
-	return context.WithValue(ctx, contextScanTimeout, t)
+func lookup(ctx context.Context, key contextKey) interface{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Value(key)
+}
+
+// ContextWithScanTimeout sets the scan timeout in the context.
+//
+// Deprecated: Use miflora.WithScanTimeout instead.
+func ContextWithScanTimeout(ctx context.Context, v time.Duration) context.Context {
+	return context.WithValue(ctx, contextScanTimeout, v)
+}
+
+// LookupScanTimeout returns the scan timeout, if set in the context.
+func LookupScanTimeout(ctx context.Context) (time.Duration, bool) {
+	v, ok := lookup(ctx, contextScanTimeout).(time.Duration)
+	return v, ok
 }
 
 func ScanTimeoutFromContext(ctx context.Context) time.Duration {
-	if ctx != nil {
-		if v := ctx.Value(contextScanTimeout); v != nil {
-			if v, ok := v.(time.Duration); ok {
-				return v
-			}
-		}
+	if v, ok := LookupScanTimeout(ctx); ok {
+		return v
 	}
 	return 5 * time.Second
 }
 
+// ContextWithScanPassive sets whether to scan passively in the context.
+//
+// Deprecated: Use miflora.WithScanPassive instead.
 func ContextWithScanPassive(ctx context.Context, v bool) context.Context {
 	return context.WithValue(ctx, contextScanPassive, v)
 }
 
+// LookupScanPassive returns whether to scan passively, if set in the context.
+func LookupScanPassive(ctx context.Context) (bool, bool) {
+	v, ok := lookup(ctx, contextScanPassive).(bool)
+	return v, ok
+}
+
 func ScanPassiveFromContext(ctx context.Context) bool {
-	if ctx != nil {
-		if v := ctx.Value(contextScanPassive); v != nil {
-			if v, ok := v.(bool); ok {
-				return v
-			}
-		}
+	if v, ok := LookupScanPassive(ctx); ok {
+		return v
 	}
 	return false
 }
 
-func ContextWithExpectedSensors(ctx context.Context, n int64) context.Context {
-	return context.WithValue(ctx, contextExpectedSensors, n)
+// ContextWithExpectedSensors sets the number of expected sensors in the context.
+//
+// Deprecated: Use miflora.WithExpectedSensors instead.
+func ContextWithExpectedSensors(ctx context.Context, v int64) context.Context {
+	return context.WithValue(ctx, contextExpectedSensors, v)
+}
+
+// LookupExpectedSensors returns the number of expected sensors, if set in the context.
+func LookupExpectedSensors(ctx context.Context) (int64, bool) {
+	v, ok := lookup(ctx, contextExpectedSensors).(int64)
+	return v, ok
 }
 
 func ExpectedSensorsFromContext(ctx context.Context) int64 {
-	if ctx != nil {
-		if v := ctx.Value(contextExpectedSensors); v != nil {
-			if v, ok := v.(int64); ok {
-				return v
-			}
-		}
+	if v, ok := LookupExpectedSensors(ctx); ok {
+		return v
 	}
 	return 0
 }
 
+// ContextWithSensorNames sets the names of sensors in the context.
+//
+// Deprecated: Use miflora.WithSensorNames instead.
 func ContextWithSensorNames(ctx context.Context, v []string) context.Context {
 	return context.WithValue(ctx, contextSensorNames, v)
 }
 
+// LookupSensorNames returns the names of sensors, if set in the context.
+func LookupSensorNames(ctx context.Context) ([]string, bool) {
+	v, ok := lookup(ctx, contextSensorNames).([]string)
+	return v, ok
+}
+
 func SensorsNamesFromContext(ctx context.Context) []string {
-	if ctx != nil {
-		if v := ctx.Value(contextSensorNames); v != nil {
-			if v, ok := v.([]string); ok {
-				return v
-			}
-		}
+	if v, ok := LookupSensorNames(ctx); ok {
+		return v
 	}
 	return []string{}
 }
 
+// ContextWithResultChannel sets the channel receiving results in the context.
+//
+// Deprecated: Use miflora.WithResults instead.
 func ContextWithResultChannel(ctx context.Context, c chan *model.Result) context.Context {
 	return context.WithValue(ctx, contextResultChannel, c)
 }
 
+// LookupResultChannel returns the channel receiving results, if set in the context.
+func LookupResultChannel(ctx context.Context) (chan *model.Result, bool) {
+	v, ok := lookup(ctx, contextResultChannel).(chan *model.Result)
+	return v, ok
+}
+
 func ResultChannelFromContext(ctx context.Context) chan *model.Result {
-	if ctx != nil {
-		if c := ctx.Value(contextResultChannel); c != nil {
-			if c, ok := c.(chan *model.Result); ok {
-				return c
-			}
-		}
+	if v, ok := LookupResultChannel(ctx); ok {
+		return v
 	}
 	return nil
 }
 
+// ContextWithBindAddress sets the listen address of the exporter in the context.
+//
+// Deprecated: Use miflora.WithBindAddress instead.
 func ContextWithBindAddress(ctx context.Context, v string) context.Context {
 	return context.WithValue(ctx, contextBindAddress, v)
 }
 
+// LookupBindAddress returns the listen address of the exporter, if set in the context.
+func LookupBindAddress(ctx context.Context) (string, bool) {
+	v, ok := lookup(ctx, contextBindAddress).(string)
+	return v, ok
+}
+
 func BindAddressFromContext(ctx context.Context) string {
-	if ctx != nil {
-		if v := ctx.Value(contextBindAddress); v != nil {
-			if v, ok := v.(string); ok {
-				return v
-			}
-		}
+	if v, ok := LookupBindAddress(ctx); ok {
+		return v
 	}
 	return ":9294"
 }
+
+// ContextWithMetricsTimestamps sets whether metrics are exposed with timestamps in the context.
+//
+// Deprecated: Use miflora.WithMetricsTimestamps instead.
+func ContextWithMetricsTimestamps(ctx context.Context, v bool) context.Context {
+	return context.WithValue(ctx, contextMetricsTimestamps, v)
+}
+
+// LookupMetricsTimestamps returns whether metrics are exposed with timestamps, if set in the context.
+func LookupMetricsTimestamps(ctx context.Context) (bool, bool) {
+	v, ok := lookup(ctx, contextMetricsTimestamps).(bool)
+	return v, ok
+}
+
+// ContextWithReadyWindow sets the ready window of the exporter in the context.
+//
+// Deprecated: Use miflora.WithReadyWindow instead.
+func ContextWithReadyWindow(ctx context.Context, v time.Duration) context.Context {
+	return context.WithValue(ctx, contextReadyWindow, v)
+}
+
+// LookupReadyWindow returns the ready window of the exporter, if set in the context.
+func LookupReadyWindow(ctx context.Context) (time.Duration, bool) {
+	v, ok := lookup(ctx, contextReadyWindow).(time.Duration)
+	return v, ok
+}
+
+// ContextWithUnits sets the units of measurements in the context.
+//
+// Deprecated: Use miflora.WithUnits instead.
+func ContextWithUnits(ctx context.Context, v model.Units) context.Context {
+	return context.WithValue(ctx, contextUnits, v)
+}
+
+// LookupUnits returns the units of measurements, if set in the context.
+func LookupUnits(ctx context.Context) (model.Units, bool) {
+	v, ok := lookup(ctx, contextUnits).(model.Units)
+	return v, ok
+}
+
+// ContextWithConcurrency sets the number of concurrent sessions in the context.
+//
+// Deprecated: Use miflora.WithConcurrency instead.
+func ContextWithConcurrency(ctx context.Context, v int) context.Context {
+	return context.WithValue(ctx, contextConcurrency, v)
+}
+
+// LookupConcurrency returns the number of concurrent sessions, if set in the context.
+func LookupConcurrency(ctx context.Context) (int, bool) {
+	v, ok := lookup(ctx, contextConcurrency).(int)
+	return v, ok
+}
+
+// ContextWithSensorTimeout sets the timeout of a session in the context.
+//
+// Deprecated: Use miflora.WithSensorTimeout instead.
+func ContextWithSensorTimeout(ctx context.Context, v time.Duration) context.Context {
+	return context.WithValue(ctx, contextSensorTimeout, v)
+}
+
+// LookupSensorTimeout returns the timeout of a session, if set in the context.
+func LookupSensorTimeout(ctx context.Context) (time.Duration, bool) {
+	v, ok := lookup(ctx, contextSensorTimeout).(time.Duration)
+	return v, ok
+}
+
+// ContextWithHistorySince sets the start of the history window in the context.
+//
+// Deprecated: Use miflora.WithHistoryWindow instead.
+func ContextWithHistorySince(ctx context.Context, v time.Time) context.Context {
+	return context.WithValue(ctx, contextHistorySince, v)
+}
+
+// LookupHistorySince returns the start of the history window, if set in the context.
+func LookupHistorySince(ctx context.Context) (time.Time, bool) {
+	v, ok := lookup(ctx, contextHistorySince).(time.Time)
+	return v, ok
+}
+
+// ContextWithHistoryUntil sets the end of the history window in the context.
+//
+// Deprecated: Use miflora.WithHistoryWindow instead.
+func ContextWithHistoryUntil(ctx context.Context, v time.Time) context.Context {
+	return context.WithValue(ctx, contextHistoryUntil, v)
+}
+
+// LookupHistoryUntil returns the end of the history window, if set in the context.
+func LookupHistoryUntil(ctx context.Context) (time.Time, bool) {
+	v, ok := lookup(ctx, contextHistoryUntil).(time.Time)
+	return v, ok
+}
+
+// ContextWithHistoryMaxRecords sets the maximum number of history records in the context.
+//
+// Deprecated: Use miflora.WithHistoryMaxRecords instead.
+func ContextWithHistoryMaxRecords(ctx context.Context, v int) context.Context {
+	return context.WithValue(ctx, contextHistoryMaxRecords, v)
+}
+
+// LookupHistoryMaxRecords returns the maximum number of history records, if set in the context.
+func LookupHistoryMaxRecords(ctx context.Context) (int, bool) {
+	v, ok := lookup(ctx, contextHistoryMaxRecords).(int)
+	return v, ok
+}
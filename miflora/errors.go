@@ -0,0 +1,40 @@
+package miflora
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCharacteristicNotFound is returned when a sensor doesn't provide a
+	// characteristic.
+	ErrCharacteristicNotFound = errors.New("characteristic not found")
+	// ErrDisconnected is returned by operations, which failed because the
+	// connection to the sensor is closed.
+	ErrDisconnected = errors.New("disconnected from sensor")
+	// ErrInvalidData is returned when the data read from a sensor can't be
+	// decoded.
+	ErrInvalidData = errors.New("invalid data")
+	// ErrHistoryChanged is returned when resuming from a cursor, which no
+	// longer matches the history of the sensor, e.g. after it has been
+	// cleared.
+	ErrHistoryChanged = errors.New("history changed since the cursor")
+	// ErrAdapterUnavailable is returned when the adapter couldn't be reopened
+	// after an error.
+	ErrAdapterUnavailable = errors.New("adapter unavailable")
+)
+
+// OperationError is returned by failed operations of the Client.
+type OperationError struct {
+	// Op is the failed operation, e.g. firmware or history_measurement.
+	Op  string
+	Err error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
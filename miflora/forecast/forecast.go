@@ -0,0 +1,222 @@
+package forecast
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	mprom "github.com/simonswine/mi-flora-exporter/outputs/prometheus"
+)
+
+// Config controls how the moisture is forecasted.
+type Config struct {
+	// Threshold is the moisture in percent used for sensors without a plant
+	// profile. If it is 0 only sensors with a plant profile are forecasted.
+	Threshold float64
+	// ResetIncrease is the increase of moisture in percentage points between
+	// two samples, which starts a new decline.
+	ResetIncrease float64
+	// Window is the longest time span of samples used for the fit.
+	Window time.Duration
+	// Resolution is the minimum time between two samples used for the fit.
+	Resolution time.Duration
+	// MinSpan is the minimum time span of the decline before forecasting.
+	MinSpan time.Duration
+}
+
+// DefaultConfig returns the default configuration.
+func DefaultConfig() Config {
+	return Config{
+		ResetIncrease: 5,
+		Window:        14 * 24 * time.Hour,
+		Resolution:    10 * time.Minute,
+		MinSpan:       6 * time.Hour,
+	}
+}
+
+// minSamples is the minimum number of samples required for a fit.
+const minSamples = 3
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+type sensor struct {
+	name    string
+	address string
+
+	// samples sorted by time
+	samples []sample
+	// threshold of the plant profile
+	threshold *float64
+
+	forecast *model.MoistureForecast
+}
+
+func (s *sensor) insert(c sample, resolution time.Duration) {
+	pos := sort.Search(len(s.samples), func(i int) bool {
+		return !s.samples[i].t.Before(c.t)
+	})
+	// only keep a single sample per resolution
+	if pos > 0 && c.t.Sub(s.samples[pos-1].t) < resolution {
+		s.samples[pos-1] = c
+		return
+	}
+	if pos < len(s.samples) && s.samples[pos].t.Sub(c.t) < resolution {
+		s.samples[pos] = c
+		return
+	}
+	s.samples = append(s.samples, sample{})
+	copy(s.samples[pos+1:], s.samples[pos:])
+	s.samples[pos] = c
+}
+
+// decline returns the samples since the last increase.
+func (s *sensor) decline(resetIncrease float64) []sample {
+	pos := len(s.samples) - 1
+	for ; pos > 0; pos-- {
+		if s.samples[pos].v-s.samples[pos-1].v >= resetIncrease {
+			break
+		}
+	}
+	return s.samples[pos:]
+}
+
+// fit returns the linear least squares fit of the samples, the slope is in
+// percentage points per hour.
+func fit(samples []sample) (intercept, slope float64) {
+	t0 := samples[0].t
+	var sumX, sumY, sumXX, sumXY float64
+	for _, s := range samples {
+		x := s.t.Sub(t0).Hours()
+		sumX += x
+		sumY += s.v
+		sumXX += x * x
+		sumXY += x * s.v
+	}
+	n := float64(len(samples))
+	d := n*sumXX - sumX*sumX
+	if d == 0 {
+		return sumY / n, 0
+	}
+	slope = (n*sumXY - sumX*sumY) / d
+	intercept = (sumY - slope*sumX) / n
+	return intercept, slope
+}
+
+// Forecaster fits the decline of moisture since the last watering and
+// predicts when it falls below the minimum moisture of the plant. It needs to
+// run after the plant evaluator. It implements pipeline.Processor and
+// prometheus.Collector.
+type Forecaster struct {
+	cfg Config
+
+	mu      sync.Mutex
+	sensors map[string]*sensor
+
+	crossing *prometheus.Desc
+}
+
+func New(cfg Config) *Forecaster {
+	return &Forecaster{
+		cfg:      cfg,
+		sensors:  make(map[string]*sensor),
+		crossing: mprom.NewDesc(prometheus.Opts(mprom.MetricOptsMoisturePredictedThresholdCrossing)),
+	}
+}
+
+func (f *Forecaster) forecast(s *sensor) *model.MoistureForecast {
+	threshold := f.cfg.Threshold
+	if s.threshold != nil {
+		threshold = *s.threshold
+	}
+	if threshold <= 0 {
+		return nil
+	}
+
+	samples := s.decline(f.cfg.ResetIncrease)
+	if len(samples) < minSamples || samples[len(samples)-1].t.Sub(samples[0].t) < f.cfg.MinSpan {
+		return nil
+	}
+
+	intercept, slope := fit(samples)
+	if slope >= 0 {
+		return nil
+	}
+
+	hours := (threshold - intercept) / slope
+	return &model.MoistureForecast{
+		Threshold:         threshold,
+		Rate:              slope,
+		ThresholdCrossing: samples[0].t.Add(time.Duration(hours * float64(time.Hour))),
+	}
+}
+
+// Process implements pipeline.Processor. The forecast is added to results
+// with a moisture measurement.
+func (f *Forecaster) Process(r *model.Result) []*model.Result {
+	results := []*model.Result{r}
+	if r.Measurement == nil || r.Measurement.Moisture == nil || r.Timestamp == nil {
+		return results
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.ToLower(r.Address)
+	s, ok := f.sensors[key]
+	if !ok {
+		s = &sensor{address: r.Address}
+		f.sensors[key] = s
+	}
+	s.name = r.Name
+	for _, c := range r.Conditions {
+		if c.Dimension == model.FieldMoisture && c.Min != nil {
+			threshold := *c.Min
+			s.threshold = &threshold
+		}
+	}
+
+	s.insert(sample{t: *r.Timestamp, v: float64(*r.Measurement.Moisture)}, f.cfg.Resolution)
+	if newest := s.samples[len(s.samples)-1].t; s.samples[0].t.Before(newest.Add(-f.cfg.Window)) {
+		pos := sort.Search(len(s.samples), func(i int) bool {
+			return !s.samples[i].t.Before(newest.Add(-f.cfg.Window))
+		})
+		s.samples = append(s.samples[:0], s.samples[pos:]...)
+	}
+
+	s.forecast = f.forecast(s)
+	if s.forecast != nil {
+		forecast := *s.forecast
+		r.MoistureForecast = &forecast
+	}
+	return results
+}
+
+// Describe implements prometheus.Collector.
+func (f *Forecaster) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.crossing
+}
+
+// Collect implements prometheus.Collector.
+func (f *Forecaster) Collect(ch chan<- prometheus.Metric) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, s := range f.sensors {
+		if s.forecast == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			f.crossing,
+			prometheus.GaugeValue,
+			float64(s.forecast.ThresholdCrossing.Unix()),
+			s.address, s.name,
+		)
+	}
+}
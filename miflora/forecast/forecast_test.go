@@ -0,0 +1,82 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func result(t time.Time, moisture uint8, min float64) *model.Result {
+	return &model.Result{
+		Name:        "fern",
+		Address:     "c4:7c:8d:aa:bb:cc",
+		Timestamp:   &t,
+		Measurement: &model.Measurement{Moisture: &moisture},
+		Conditions: []model.Condition{
+			{Dimension: model.FieldMoisture, Value: float64(moisture), Min: &min},
+		},
+	}
+}
+
+func TestForecaster(t *testing.T) {
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	f := New(DefaultConfig())
+
+	// decline before watering is ignored
+	for h, v := range []uint8{30, 25, 20} {
+		r := result(start.Add(time.Duration(h)*time.Hour), v, 15)
+		f.Process(r)
+	}
+
+	// after watering the moisture declines by 1 percentage point every 2 hours
+	var r *model.Result
+	for h := 0; h <= 10; h++ {
+		r = result(start.Add(time.Duration(3+h)*time.Hour), uint8(45-h/2), 15)
+		f.Process(r)
+	}
+
+	require.NotNil(t, r.MoistureForecast)
+	assert.Equal(t, 15.0, r.MoistureForecast.Threshold)
+	assert.InDelta(t, -0.5, r.MoistureForecast.Rate, 0.05)
+	expected := start.Add(63 * time.Hour)
+	assert.WithinDuration(t, expected, r.MoistureForecast.ThresholdCrossing, 3*time.Hour)
+}
+
+func TestForecasterInsufficientData(t *testing.T) {
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("no threshold", func(t *testing.T) {
+		f := New(DefaultConfig())
+		var r *model.Result
+		for h := 0; h <= 10; h++ {
+			r = result(start.Add(time.Duration(h)*time.Hour), uint8(45-h), 0)
+			r.Conditions = nil
+			f.Process(r)
+		}
+		assert.Nil(t, r.MoistureForecast)
+	})
+
+	t.Run("too short", func(t *testing.T) {
+		f := New(DefaultConfig())
+		var r *model.Result
+		for m := 0; m <= 5; m++ {
+			r = result(start.Add(time.Duration(m)*time.Hour), uint8(45-m), 15)
+			f.Process(r)
+		}
+		assert.Nil(t, r.MoistureForecast)
+	})
+
+	t.Run("increasing", func(t *testing.T) {
+		f := New(DefaultConfig())
+		var r *model.Result
+		for h := 0; h <= 10; h++ {
+			r = result(start.Add(time.Duration(h)*time.Hour), uint8(30+h/3), 15)
+			f.Process(r)
+		}
+		assert.Nil(t, r.MoistureForecast)
+	})
+}
@@ -0,0 +1,125 @@
+package miflora
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+const (
+	// frameDuplicateWindow is the time within a repeated frame counter is
+	// considered a duplicate, afterwards the counter might have wrapped
+	// around
+	frameDuplicateWindow = time.Minute
+	// maxFrameGap is the time after which gaps of the frame counter are not
+	// counted as missed frames, as the counter might have wrapped around
+	// more than once
+	maxFrameGap = 10 * time.Minute
+	// maxMissedFrames limits the frames counted as missed for a single gap,
+	// larger gaps are more likely caused by a reboot or frames received out
+	// of order
+	maxMissedFrames = 128
+	// maxLateFrames is the distance behind the last counter within frames
+	// are late copies of frames received before, larger jumps backwards are
+	// caused by a reset of the counter, e.g. by a reboot
+	maxLateFrames = 16
+)
+
+type frameState struct {
+	counter  uint8
+	seen     time.Time
+	received uint64
+	missed   uint64
+}
+
+// frameTracker tracks the last frame counter of sensors, to detect repeated
+// frames and to estimate the frames missed.
+type frameTracker struct {
+	mu      sync.Mutex
+	sensors map[string]*frameState
+}
+
+func newFrameTracker() *frameTracker {
+	return &frameTracker{
+		sensors: make(map[string]*frameState),
+	}
+}
+
+// observe records a frame of the sensor. It returns whether the frame has
+// been received before, which includes frames received out of order, and the
+// number of frames missed since the previous frame.
+func (t *frameTracker) observe(addr string, counter uint8, at time.Time) (duplicate bool, missed int) {
+	if t == nil {
+		return false, 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	addr = strings.ToLower(addr)
+	s, ok := t.sensors[addr]
+	if !ok {
+		t.sensors[addr] = &frameState{counter: counter, seen: at, received: 1}
+		return false, 0
+	}
+
+	// the counter wraps around after 255
+	gap := int(counter - s.counter)
+
+	// frames shortly behind the last counter are late copies of frames
+	// received before, they are ignored to not count the following frames
+	// twice
+	elapsed := at.Sub(s.seen)
+	if (gap == 0 || gap >= 256-maxLateFrames) && elapsed < frameDuplicateWindow {
+		return true, 0
+	}
+
+	if gap > 1 && gap <= maxMissedFrames && elapsed < maxFrameGap {
+		missed = gap - 1
+	}
+	s.counter = counter
+	s.seen = at
+	s.received++
+	s.missed += uint64(missed)
+	return false, missed
+}
+
+// ratio returns the fraction of the frames of the sensor, which have been
+// received.
+func (t *frameTracker) ratio(addr string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sensors[strings.ToLower(addr)]
+	if !ok || s.received == 0 {
+		return 0
+	}
+	return float64(s.received) / float64(s.received+s.missed)
+}
+
+// observeFrame tracks the frame counter of the advertisement and returns
+// true for frames, which have been received before.
+func (m *MiFlora) observeFrame(adv *model.Advertisement) bool {
+	if m.frames == nil {
+		return false
+	}
+
+	duplicate, missed := m.frames.observe(adv.Address, adv.FrameCounter, adv.Timestamp)
+	if duplicate {
+		if m.metrics != nil {
+			m.metrics.duplicateFrames.WithLabelValues(adv.Address).Inc()
+		}
+		return true
+	}
+	if missed > 0 {
+		_ = level.Debug(m.logger).Log("msg", "missed advertisement frames", "address", adv.Address, "missed", missed, "frame_counter", adv.FrameCounter)
+	}
+	if m.metrics != nil {
+		m.metrics.missedFrames.WithLabelValues(adv.Address).Add(float64(missed))
+		m.metrics.receptionRatio.WithLabelValues(adv.Address).Set(m.frames.ratio(adv.Address))
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package miflora
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func TestFrameTracker(t *testing.T) {
+	const addr = "c4:7c:8d:aa:bb:cc"
+	start := time.Unix(1600000000, 0)
+	tracker := newFrameTracker()
+
+	for _, tc := range []struct {
+		name      string
+		counter   uint8
+		after     time.Duration
+		duplicate bool
+		missed    int
+	}{
+		{name: "first frame", counter: 250},
+		{name: "next frame", counter: 251, after: 3 * time.Second},
+		{name: "repeated frame", counter: 251, after: 4 * time.Second, duplicate: true},
+		{name: "gap", counter: 254, after: 15 * time.Second, missed: 2},
+		{name: "wraparound", counter: 1, after: 30 * time.Second, missed: 2},
+		{name: "long gap", counter: 50, after: 20 * time.Minute},
+		{name: "same counter after a while", counter: 50, after: 22 * time.Minute},
+		{name: "out of order", counter: 40, after: 22*time.Minute + time.Second, duplicate: true},
+		{name: "after out of order", counter: 51, after: 22*time.Minute + 2*time.Second},
+	} {
+		duplicate, missed := tracker.observe(addr, tc.counter, start.Add(tc.after))
+		if tc.duplicate != duplicate {
+			t.Errorf("%s: unexpected duplicate exp: %v, act: %v", tc.name, tc.duplicate, duplicate)
+		}
+		if tc.missed != missed {
+			t.Errorf("%s: unexpected missed frames exp: %d, act: %d", tc.name, tc.missed, missed)
+		}
+	}
+
+	// 7 frames received, 4 missed
+	if exp, act := 7.0/11.0, tracker.ratio("C4:7C:8D:AA:BB:CC"); exp != act {
+		t.Errorf("unexpected ratio exp: %v, act: %v", exp, act)
+	}
+}
+
+func TestFrameTrackerReordered(t *testing.T) {
+	const addr = "c4:7c:8d:aa:bb:cc"
+	start := time.Unix(1600000000, 0)
+	tracker := newFrameTracker()
+
+	for i, tc := range []struct {
+		counter   uint8
+		duplicate bool
+	}{
+		{counter: 9},
+		{counter: 10},
+		// frame 9 received after frame 10
+		{counter: 9, duplicate: true},
+		// a re-broadcast of frame 10 is still a duplicate
+		{counter: 10, duplicate: true},
+		{counter: 11},
+	} {
+		duplicate, missed := tracker.observe(addr, tc.counter, start.Add(time.Duration(i)*time.Second))
+		if exp, act := tc.duplicate, duplicate; exp != act {
+			t.Errorf("frame %d: unexpected duplicate exp: %v, act: %v", i, exp, act)
+		}
+		if exp, act := 0, missed; exp != act {
+			t.Errorf("frame %d: unexpected missed frames exp: %d, act: %d", i, exp, act)
+		}
+	}
+
+	if exp, act := 1.0, tracker.ratio(addr); exp != act {
+		t.Errorf("unexpected ratio exp: %v, act: %v", exp, act)
+	}
+}
+
+func TestObserveFrame(t *testing.T) {
+	m := &MiFlora{
+		logger:  log.NewNopLogger(),
+		metrics: newMetrics(prometheus.NewRegistry()),
+		frames:  newFrameTracker(),
+	}
+	const addr = "c4:7c:8d:aa:bb:cc"
+	now := time.Now()
+
+	for i, counter := range []uint8{1, 1, 2, 5} {
+		duplicate := m.observeFrame(&model.Advertisement{Address: addr, FrameCounter: counter, Timestamp: now.Add(time.Duration(i) * time.Second)})
+		if exp, act := i == 1, duplicate; exp != act {
+			t.Errorf("unexpected duplicate for frame %d exp: %v, act: %v", i, exp, act)
+		}
+	}
+
+	if exp, act := 1.0, testutil.ToFloat64(m.metrics.duplicateFrames.WithLabelValues(addr)); exp != act {
+		t.Errorf("unexpected duplicate frames exp: %v, act: %v", exp, act)
+	}
+	if exp, act := 2.0, testutil.ToFloat64(m.metrics.missedFrames.WithLabelValues(addr)); exp != act {
+		t.Errorf("unexpected missed frames exp: %v, act: %v", exp, act)
+	}
+	if exp, act := 0.6, testutil.ToFloat64(m.metrics.receptionRatio.WithLabelValues(addr)); exp != act {
+		t.Errorf("unexpected reception ratio exp: %v, act: %v", exp, act)
+	}
+}
+
+func TestFrameTrackerReset(t *testing.T) {
+	const addr = "c4:7c:8d:aa:bb:cc"
+	start := time.Unix(1600000000, 0)
+	tracker := newFrameTracker()
+
+	for i, counter := range []uint8{100, 101, 102, 0, 1, 2} {
+		// the sensor reboots after frame 102 and starts counting from 0
+		duplicate, missed := tracker.observe(addr, counter, start.Add(time.Duration(i)*time.Second))
+		if exp, act := false, duplicate; exp != act {
+			t.Errorf("frame %d: unexpected duplicate exp: %v, act: %v", i, exp, act)
+		}
+		if exp, act := 0, missed; exp != act {
+			t.Errorf("frame %d: unexpected missed frames exp: %d, act: %d", i, exp, act)
+		}
+	}
+
+	if exp, act := 1.0, tracker.ratio(addr); exp != act {
+		t.Errorf("unexpected ratio exp: %v, act: %v", exp, act)
+	}
+}
@@ -0,0 +1,107 @@
+package miflora
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthyPath = "/-/healthy"
+	readyPath   = "/-/ready"
+)
+
+// health tracks the state of the adapter and the scan loop.
+type health struct {
+	mu                sync.Mutex
+	deviceOpen        bool
+	scanning          bool
+	lastAdvertisement time.Time
+
+	// window in which an advertisement needs to be received to be ready
+	window time.Duration
+	now    func() time.Time
+}
+
+type healthStatus struct {
+	Status            string     `json:"status"`
+	DeviceOpen        bool       `json:"device_open"`
+	Scanning          bool       `json:"scanning"`
+	LastAdvertisement *time.Time `json:"last_advertisement,omitempty"`
+}
+
+func newHealth(window time.Duration) *health {
+	return &health{
+		window: window,
+		now:    time.Now,
+	}
+}
+
+func (h *health) setDeviceOpen(v bool) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deviceOpen = v
+}
+
+func (h *health) setScanning(v bool) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.scanning = v
+}
+
+func (h *health) observeAdvertisement(t time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t.After(h.lastAdvertisement) {
+		h.lastAdvertisement = t
+	}
+}
+
+// status returns the current state and if the exporter is healthy and ready.
+func (h *health) status() (status healthStatus, healthy bool, ready bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status.DeviceOpen = h.deviceOpen
+	status.Scanning = h.scanning
+	if !h.lastAdvertisement.IsZero() {
+		t := h.lastAdvertisement
+		status.LastAdvertisement = &t
+	}
+
+	healthy = h.deviceOpen && h.scanning
+	ready = healthy && !h.lastAdvertisement.IsZero() && h.now().Sub(h.lastAdvertisement) <= h.window
+	return status, healthy, ready
+}
+
+func writeHealthStatus(w http.ResponseWriter, status healthStatus, ok bool, notOK string) {
+	code := http.StatusOK
+	status.Status = "ok"
+	if !ok {
+		code = http.StatusServiceUnavailable
+		status.Status = notOK
+	}
+	writeJSON(w, code, &status)
+}
+
+// healthyHandler reports if the adapter is open and the scan loop running.
+func (h *health) healthyHandler(w http.ResponseWriter, r *http.Request) {
+	status, healthy, _ := h.status()
+	writeHealthStatus(w, status, healthy, "unhealthy")
+}
+
+// readyHandler reports if the exporter is healthy and an advertisement has
+// been received within the configured window.
+func (h *health) readyHandler(w http.ResponseWriter, r *http.Request) {
+	status, _, ready := h.status()
+	writeHealthStatus(w, status, ready, "not ready")
+}
@@ -0,0 +1,44 @@
+package miflora
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	h := newHealth(5 * time.Minute)
+	h.now = func() time.Time { return now }
+
+	check := func(msg string, expHealthy, expReady int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.healthyHandler(w, httptest.NewRequest(http.MethodGet, healthyPath, nil))
+		if act := w.Code; expHealthy != act {
+			t.Errorf("%s: unexpected healthy status exp: %v, act: %v", msg, expHealthy, act)
+		}
+		w = httptest.NewRecorder()
+		h.readyHandler(w, httptest.NewRequest(http.MethodGet, readyPath, nil))
+		if act := w.Code; expReady != act {
+			t.Errorf("%s: unexpected ready status exp: %v, act: %v", msg, expReady, act)
+		}
+	}
+
+	check("initial", http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+	h.setDeviceOpen(true)
+	h.setScanning(true)
+	check("scanning", http.StatusOK, http.StatusServiceUnavailable)
+
+	h.observeAdvertisement(now.Add(-time.Minute))
+	check("advertisement received", http.StatusOK, http.StatusOK)
+
+	now = now.Add(10 * time.Minute)
+	check("advertisement too old", http.StatusOK, http.StatusServiceUnavailable)
+
+	h.observeAdvertisement(now)
+	h.setDeviceOpen(false)
+	check("device closed", http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+}
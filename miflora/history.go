@@ -0,0 +1,149 @@
+package miflora
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Cursor is the position in the history of a sensor, up to which records
+// have been read. It can be serialized to resume reading in a later
+// connection. The zero value starts at the newest record.
+type Cursor struct {
+	// Index is the position of the last record read. Records are read from
+	// the newest to the oldest, so reading continues below it.
+	Index uint16 `json:"index"`
+	// DeviceTime of the last record read, it is used to verify the history
+	// hasn't changed when resuming.
+	DeviceTime time.Time `json:"device_time"`
+}
+
+// IsZero returns true if no record has been read.
+func (c Cursor) IsZero() bool {
+	return c.DeviceTime.IsZero()
+}
+
+// Done returns true once the oldest record has been read.
+func (c Cursor) Done() bool {
+	return !c.IsZero() && c.Index == 0
+}
+
+// HistoryIterator walks the history of a sensor from the newest to the
+// oldest record. Records are only read on calls to Next, so callers can
+// stop at any point and resume later from the Cursor.
+type HistoryIterator struct {
+	ctx    context.Context
+	c      *Client
+	cursor Cursor
+
+	started bool
+	length  uint16
+
+	measurement *HistoricMeasurement
+	err         error
+}
+
+// History returns an iterator over the history records of the sensor, which
+// starts below the given cursor. Failed reads are retried according to the
+// retry policy.
+func (c *Client) History(ctx context.Context, from Cursor) *HistoryIterator {
+	return &HistoryIterator{ctx: ctx, c: c, cursor: from}
+}
+
+// start reads the length of the history, which is required before reading
+// records. A cursor to resume from is verified by reading its record again.
+func (it *HistoryIterator) start() error {
+	if err := it.c.do(it.ctx, opHistoryLength, func() (err error) {
+		it.length, err = it.c.HistoryLength()
+		return err
+	}); err != nil {
+		return fmt.Errorf("error querying history length: %w", err)
+	}
+
+	if it.cursor.IsZero() {
+		return nil
+	}
+	if it.cursor.Index >= it.length {
+		return fmt.Errorf("%w: position %d beyond length %d", ErrHistoryChanged, it.cursor.Index, it.length)
+	}
+	hm, err := it.read(it.cursor.Index)
+	if err != nil {
+		return err
+	}
+	if !hm.DeviceTime.Equal(it.cursor.DeviceTime) {
+		return fmt.Errorf("%w: record at position %d has device time %s instead of %s", ErrHistoryChanged, it.cursor.Index, hm.DeviceTime.Format(time.RFC3339), it.cursor.DeviceTime.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (it *HistoryIterator) read(pos uint16) (hm *HistoricMeasurement, err error) {
+	if err := it.c.do(it.ctx, opHistoryMeasurement, func() (err error) {
+		hm, err = it.c.HistoryMeasurement(pos)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("error querying history measurement at position %d: %w", pos, err)
+	}
+	return hm, nil
+}
+
+// Next reads the next record. It returns false once all records have been
+// read or an error occurred.
+func (it *HistoryIterator) Next() bool {
+	it.measurement = nil
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+
+	if !it.started {
+		if err := it.start(); err != nil {
+			it.err = err
+			return false
+		}
+		it.started = true
+	}
+
+	var pos uint16
+	switch {
+	case it.cursor.IsZero() && it.length > 0:
+		pos = it.length - 1
+	case !it.cursor.IsZero() && it.cursor.Index > 0:
+		pos = it.cursor.Index - 1
+	default:
+		return false
+	}
+
+	hm, err := it.read(pos)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.measurement = hm
+	it.cursor = Cursor{Index: pos, DeviceTime: hm.DeviceTime}
+	return true
+}
+
+// Measurement returns the record read by the last call to Next.
+func (it *HistoryIterator) Measurement() *HistoricMeasurement {
+	return it.measurement
+}
+
+// Cursor returns the position of the record read by the last call to Next,
+// iterating from it continues with the following record.
+func (it *HistoryIterator) Cursor() Cursor {
+	return it.cursor
+}
+
+// Length returns the number of records in the history, it is known after
+// the first call to Next.
+func (it *HistoryIterator) Length() uint16 {
+	return it.length
+}
+
+// Err returns the error, which stopped the iteration.
+func (it *HistoryIterator) Err() error {
+	return it.err
+}
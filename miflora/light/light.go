@@ -0,0 +1,275 @@
+package light
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	mprom "github.com/simonswine/mi-flora-exporter/outputs/prometheus"
+)
+
+// Config controls how the brightness is integrated.
+type Config struct {
+	// LuxToPPFD converts the brightness in lux to the photosynthetic photon
+	// flux density in µmol/m²/s. It depends on the light source.
+	LuxToPPFD float64
+	// Threshold is the brightness in lux above which light hours are counted.
+	Threshold float64
+	// MaxGap is the longest time between two samples which is interpolated,
+	// longer gaps are not integrated.
+	MaxGap time.Duration
+}
+
+// DefaultConfig returns the default configuration, the conversion factor is
+// the one of sunlight.
+func DefaultConfig() Config {
+	return Config{
+		LuxToPPFD: 0.0185,
+		Threshold: 1000,
+		MaxGap:    2 * time.Hour,
+	}
+}
+
+// daysKept is the number of days remembered as summarised per sensor.
+const daysKept = 7
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+type sensor struct {
+	name    string
+	address string
+
+	// samples sorted by time
+	samples []sample
+	// start of the day of the last observed sample
+	day time.Time
+	// days already summarised
+	summarised map[string]bool
+}
+
+func dayStart(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (s *sensor) insert(c sample) {
+	pos := sort.Search(len(s.samples), func(i int) bool {
+		return !s.samples[i].t.Before(c.t)
+	})
+	if pos < len(s.samples) && s.samples[pos].t.Equal(c.t) {
+		s.samples[pos] = c
+		return
+	}
+	s.samples = append(s.samples, sample{})
+	copy(s.samples[pos+1:], s.samples[pos:])
+	s.samples[pos] = c
+}
+
+// prune drops samples which are neither needed for the last 24 hours nor for
+// the current day.
+func (s *sensor) prune(maxGap time.Duration) {
+	if len(s.samples) == 0 {
+		return
+	}
+	recent := s.samples[len(s.samples)-1].t.Add(-24*time.Hour - maxGap)
+	dayFrom := s.day.Add(-maxGap)
+	dayTo := s.day.AddDate(0, 0, 1).Add(maxGap)
+
+	samples := s.samples[:0]
+	for _, e := range s.samples {
+		if !e.t.Before(recent) || (!e.t.Before(dayFrom) && !e.t.After(dayTo)) {
+			samples = append(samples, e)
+		}
+	}
+	s.samples = samples
+}
+
+// Integrator integrates the brightness over time to estimate the daily light
+// integral and the hours of light. It handles results in chronological order
+// as well as in reverse order, as it is the case for history downloads. A day
+// is summarised once a sample of another day is observed, if samples before
+// and after the day show it has been observed completely. It implements
+// pipeline.Processor and prometheus.Collector.
+type Integrator struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	sensors map[string]*sensor
+
+	dli        *prometheus.Desc
+	lightHours *prometheus.Desc
+}
+
+func New(cfg Config) *Integrator {
+	return &Integrator{
+		cfg:        cfg,
+		now:        time.Now,
+		sensors:    make(map[string]*sensor),
+		dli:        mprom.NewDesc(prometheus.Opts(mprom.MetricOptsDailyLightIntegral)),
+		lightHours: mprom.NewDesc(prometheus.Opts(mprom.MetricOptsLightHours)),
+	}
+}
+
+// aboveThreshold returns the fraction of a linear segment from a to b which is
+// at or above the threshold.
+func aboveThreshold(a, b, threshold float64) float64 {
+	switch {
+	case a >= threshold && b >= threshold:
+		return 1
+	case a < threshold && b < threshold:
+		return 0
+	}
+	f := (threshold - a) / (b - a)
+	if a >= threshold {
+		return f
+	}
+	return 1 - f
+}
+
+// integrate returns the light integral in mol/m², the light hours and the
+// duration covered by samples between from and to.
+func (i *Integrator) integrate(samples []sample, from, to time.Time) (dli, lightHours float64, covered time.Duration) {
+	for pos := 1; pos < len(samples); pos++ {
+		a, b := samples[pos-1], samples[pos]
+		length := b.t.Sub(a.t)
+		if length > i.cfg.MaxGap || length <= 0 {
+			continue
+		}
+
+		start, end := a.t, b.t
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		interpolate := func(t time.Time) float64 {
+			return a.v + (b.v-a.v)*float64(t.Sub(a.t))/float64(length)
+		}
+		va, vb := interpolate(start), interpolate(end)
+		d := end.Sub(start)
+
+		dli += (va + vb) / 2 * i.cfg.LuxToPPFD * d.Seconds() / 1e6
+		lightHours += aboveThreshold(va, vb, i.cfg.Threshold) * d.Hours()
+		covered += d
+	}
+	return dli, lightHours, covered
+}
+
+// complete returns true if there are samples at or before the start and at
+// or after the end of the day, so the whole day has been observed.
+func (s *sensor) complete(day time.Time) bool {
+	if len(s.samples) == 0 {
+		return false
+	}
+	end := day.AddDate(0, 0, 1)
+	return !s.samples[0].t.After(day) && !s.samples[len(s.samples)-1].t.Before(end)
+}
+
+func (i *Integrator) summarise(s *sensor) *model.Result {
+	date := s.day.Format("2006-01-02")
+	if s.summarised[date] || !s.complete(s.day) {
+		return nil
+	}
+	s.summarised[date] = true
+	if len(s.summarised) > daysKept {
+		dates := make([]string, 0, len(s.summarised))
+		for k := range s.summarised {
+			dates = append(dates, k)
+		}
+		sort.Strings(dates)
+		for _, k := range dates[:len(dates)-daysKept] {
+			delete(s.summarised, k)
+		}
+	}
+
+	end := s.day.AddDate(0, 0, 1)
+	dli, lightHours, covered := i.integrate(s.samples, s.day, end)
+	return &model.Result{
+		Name:      s.name,
+		Address:   s.address,
+		Timestamp: &end,
+		DailyLight: &model.DailyLight{
+			Date:       date,
+			DLI:        dli,
+			LightHours: lightHours,
+			Coverage:   float64(covered) / float64(end.Sub(s.day)),
+		},
+	}
+}
+
+// Process implements pipeline.Processor. Summaries of completely observed
+// days are added as additional results.
+func (i *Integrator) Process(r *model.Result) []*model.Result {
+	results := []*model.Result{r}
+	if r.Measurement == nil || r.Measurement.Brightness == nil {
+		return results
+	}
+
+	t := i.now()
+	if r.Timestamp != nil {
+		t = *r.Timestamp
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := strings.ToLower(r.Address)
+	s, ok := i.sensors[key]
+	if !ok {
+		s = &sensor{
+			address:    r.Address,
+			summarised: make(map[string]bool),
+		}
+		i.sensors[key] = s
+	}
+	s.name = r.Name
+	s.insert(sample{t: t, v: float64(*r.Measurement.Brightness)})
+
+	if day := dayStart(t); !day.Equal(s.day) {
+		if !s.day.IsZero() {
+			if summary := i.summarise(s); summary != nil {
+				results = append(results, summary)
+			}
+		}
+		s.day = day
+	}
+	s.prune(i.cfg.MaxGap)
+
+	return results
+}
+
+// Describe implements prometheus.Collector.
+func (i *Integrator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- i.dli
+	ch <- i.lightHours
+}
+
+// Collect implements prometheus.Collector.
+func (i *Integrator) Collect(ch chan<- prometheus.Metric) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, s := range i.sensors {
+		if len(s.samples) == 0 {
+			continue
+		}
+		to := s.samples[len(s.samples)-1].t
+		dli, lightHours, _ := i.integrate(s.samples, to.Add(-24*time.Hour), to)
+		lv := []string{s.address, s.name}
+		ch <- prometheus.MustNewConstMetric(i.dli, prometheus.GaugeValue, dli, lv...)
+		ch <- prometheus.MustNewConstMetric(i.lightHours, prometheus.GaugeValue, lightHours, lv...)
+	}
+}
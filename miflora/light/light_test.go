@@ -0,0 +1,114 @@
+package light
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func result(t time.Time, brightness uint16) *model.Result {
+	return &model.Result{
+		Name:        "fern",
+		Address:     "c4:7c:8d:aa:bb:cc",
+		Timestamp:   &t,
+		Measurement: &model.Measurement{Brightness: &brightness},
+	}
+}
+
+func summaries(i *Integrator, results ...*model.Result) []*model.DailyLight {
+	var summaries []*model.DailyLight
+	for _, r := range results {
+		for _, o := range i.Process(r) {
+			if o.DailyLight != nil {
+				summaries = append(summaries, o.DailyLight)
+			}
+		}
+	}
+	return summaries
+}
+
+// day returns hourly samples with 10000 lux from 8:00 to 16:00.
+func day(start time.Time) []*model.Result {
+	results := make([]*model.Result, 0, 25)
+	for h := 0; h <= 24; h++ {
+		var v uint16
+		if h >= 8 && h <= 16 {
+			v = 10000
+		}
+		results = append(results, result(start.Add(time.Duration(h)*time.Hour), v))
+	}
+	return results
+}
+
+func TestIntegrator(t *testing.T) {
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local)
+	// 10000 lux for 8 hours and the ramps of an hour each
+	expectedDLI := 10000 * 0.0185 * 9 * 3600 / 1e6
+
+	t.Run("chronological", func(t *testing.T) {
+		i := New(DefaultConfig())
+		s := summaries(i, day(start)...)
+		require.Len(t, s, 1)
+		assert.Equal(t, "2021-05-01", s[0].Date)
+		assert.InDelta(t, expectedDLI, s[0].DLI, 1e-9)
+		assert.InDelta(t, 8+2*0.9, s[0].LightHours, 1e-9)
+		assert.InDelta(t, 1.0, s[0].Coverage, 1e-9)
+	})
+
+	t.Run("reverse chronological", func(t *testing.T) {
+		results := day(start)
+		for a, b := 0, len(results)-1; a < b; a, b = a+1, b-1 {
+			results[a], results[b] = results[b], results[a]
+		}
+		results = append(results, result(start.Add(-time.Hour), 0))
+
+		i := New(DefaultConfig())
+		s := summaries(i, results...)
+		// the newest day has only been observed partially
+		require.Len(t, s, 1)
+		assert.Equal(t, "2021-05-01", s[0].Date)
+		assert.InDelta(t, expectedDLI, s[0].DLI, 1e-9)
+		assert.InDelta(t, 1.0, s[0].Coverage, 1e-9)
+	})
+
+	t.Run("partial days are not summarised", func(t *testing.T) {
+		// started observing at noon
+		results := day(start)[12:]
+		results = append(results, result(start.Add(25*time.Hour), 0))
+
+		i := New(DefaultConfig())
+		assert.Empty(t, summaries(i, results...))
+	})
+
+	t.Run("gaps are not integrated", func(t *testing.T) {
+		results := day(start)
+		// drop samples from 10:00 to 13:00
+		results = append(results[:10], results[14:]...)
+
+		i := New(DefaultConfig())
+		s := summaries(i, results...)
+		require.Len(t, s, 1)
+		assert.InDelta(t, expectedDLI*4/9, s[0].DLI, 1e-9)
+		assert.InDelta(t, 19.0/24, s[0].Coverage, 1e-9)
+	})
+}
+
+func TestIntegratorMetrics(t *testing.T) {
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local)
+	i := New(DefaultConfig())
+	for _, r := range day(start) {
+		i.Process(r)
+	}
+
+	assert.NoError(t, testutil.CollectAndCompare(i, strings.NewReader(`
+# HELP flowercare_light_hours Hours with a brightness above the threshold in the last 24 hours.
+# TYPE flowercare_light_hours gauge
+flowercare_light_hours{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 9.8
+`), "flowercare_light_hours"))
+}
@@ -0,0 +1,259 @@
+package miflora
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/advertisements"
+	mprom "github.com/simonswine/mi-flora-exporter/outputs/prometheus"
+)
+
+// subsystem used by the metrics about the exporter itself
+const metricsSubsystem = "exporter"
+
+const (
+	labelType      = "type"
+	labelReason    = "reason"
+	labelID        = "id"
+	labelOperation = "operation"
+)
+
+// GATT operations instrumented by the client.
+const (
+	opDial               = "dial"
+	opDiscoverProfile    = "discover_profile"
+	opFirmware           = "firmware"
+	opMeasurement        = "measurement"
+	opDeviceTime         = "device_time"
+	opHistoryLength      = "history_length"
+	opHistoryMeasurement = "history_measurement"
+	opBlinkLED           = "blink_led"
+	opClearHistory       = "clear_history"
+)
+
+// advertisement type used for frames without a measurement
+const advertisementTypeNone = "none"
+
+// metrics contains internal metrics about the BLE pipeline.
+type metrics struct {
+	advertisementsReceived *prometheus.CounterVec
+	parseErrors            *prometheus.CounterVec
+	unknownMeasurementIDs  *prometheus.CounterVec
+	scanRestarts           prometheus.Counter
+	hciErrors              prometheus.Counter
+	gattOperations         *prometheus.CounterVec
+	gattFailures           *prometheus.CounterVec
+	gattDuration           *prometheus.HistogramVec
+	historyRecords         *prometheus.CounterVec
+	retries                *prometheus.CounterVec
+	consecutiveFailures    *prometheus.GaugeVec
+	historyThroughput      *prometheus.GaugeVec
+	historyBatchSize       *prometheus.GaugeVec
+	clockDrift             *prometheus.GaugeVec
+	uptime                 *prometheus.GaugeVec
+	duplicateFrames        *prometheus.CounterVec
+	missedFrames           *prometheus.CounterVec
+	receptionRatio         *prometheus.GaugeVec
+}
+
+func newMetrics(r prometheus.Registerer) *metrics {
+	return &metrics{
+		advertisementsReceived: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "advertisements_received_total",
+			Help:      "Total number of advertisements received by type of the contained measurement.",
+		}, []string{labelType, mprom.LabelAddress}),
+		parseErrors: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "advertisement_parse_errors_total",
+			Help:      "Total number of advertisements which failed to parse by reason.",
+		}, []string{labelReason}),
+		unknownMeasurementIDs: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "unknown_measurements_total",
+			Help:      "Total number of advertisements with an unknown measurement object ID.",
+		}, []string{labelID}),
+		scanRestarts: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "scan_restarts_total",
+			Help:      "Total number of times the scan for advertisements has been restarted.",
+		}),
+		hciErrors: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "hci_errors_total",
+			Help:      "Total number of errors returned by the HCI device.",
+		}),
+		gattOperations: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "gatt_operations_total",
+			Help:      "Total number of GATT operations attempted.",
+		}, []string{labelOperation}),
+		gattFailures: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "gatt_operation_failures_total",
+			Help:      "Total number of GATT operations failed.",
+		}, []string{labelOperation}),
+		gattDuration: promauto.With(r).NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "gatt_operation_duration_seconds",
+			Help:      "Duration of GATT operations.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{labelOperation}),
+		historyRecords: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "history_records_downloaded_total",
+			Help:      "Total number of history records downloaded from sensors.",
+		}, []string{mprom.LabelAddress}),
+		retries: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "gatt_operation_retries_total",
+			Help:      "Total number of GATT operations retried after a transient error.",
+		}, []string{labelOperation}),
+		consecutiveFailures: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "sensor_consecutive_failures",
+			Help:      "Number of consecutive failed connections to a sensor.",
+		}, []string{mprom.LabelAddress}),
+		historyThroughput: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "history_download_records_per_second",
+			Help:      "Number of history records downloaded per second during the last connection to a sensor.",
+		}, []string{mprom.LabelAddress}),
+		historyBatchSize: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "history_batch_size",
+			Help:      "Number of history records read during the next connection to a sensor.",
+		}, []string{mprom.LabelAddress}),
+		clockDrift: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "sensor_clock_drift_ratio",
+			Help:      "Estimated drift of the sensor clock, as seconds gained per second.",
+		}, []string{mprom.LabelAddress}),
+		uptime: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "sensor_uptime_seconds",
+			Help:      "Seconds since the sensor booted, as reported by the sensor clock.",
+		}, []string{mprom.LabelAddress}),
+		duplicateFrames: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "advertisement_duplicate_frames_total",
+			Help:      "Total number of advertisement frames received more than once, which have been dropped.",
+		}, []string{mprom.LabelAddress}),
+		missedFrames: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "advertisement_missed_frames_total",
+			Help:      "Estimated total number of advertisement frames missed, based on gaps of the frame counter.",
+		}, []string{mprom.LabelAddress}),
+		receptionRatio: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: mprom.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "advertisement_reception_ratio",
+			Help:      "Estimated fraction of the advertisement frames of a sensor, which have been received.",
+		}, []string{mprom.LabelAddress}),
+	}
+}
+
+// observeGATT records a single GATT operation.
+func (m *metrics) observeGATT(operation string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.gattOperations.WithLabelValues(operation).Inc()
+	m.gattDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.gattFailures.WithLabelValues(operation).Inc()
+	}
+}
+
+// observeRetry records a retried GATT operation.
+func (m *metrics) observeRetry(operation string) {
+	if m == nil {
+		return
+	}
+	m.retries.WithLabelValues(operation).Inc()
+}
+
+// observeParseError records an advertisement, that couldn't be parsed.
+func (m *metrics) observeParseError(err error) {
+	if m == nil {
+		return
+	}
+	var unknownErr *advertisements.UnknownMeasurementError
+	if errors.As(err, &unknownErr) {
+		m.unknownMeasurementIDs.WithLabelValues(fmt.Sprintf("0x%04x", unknownErr.ID)).Inc()
+	}
+	m.parseErrors.WithLabelValues(parseErrorReason(err)).Inc()
+}
+
+func parseErrorReason(err error) string {
+	var unknownErr *advertisements.UnknownMeasurementError
+	switch {
+	case errors.Is(err, advertisements.ErrFrameTooShort):
+		return "frame_too_short"
+	case errors.Is(err, advertisements.ErrNotMeasurement):
+		return "not_measurement"
+	case errors.Is(err, advertisements.ErrMeasurementTooShort):
+		return "measurement_too_short"
+	case errors.As(err, &unknownErr):
+		return "unknown_measurement"
+	default:
+		return "other"
+	}
+}
+
+// metricsHandler exposes the metrics registry.
+func (m *MiFlora) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// serveMetrics serves the metrics registry on the address, until the
+// returned function is called. Nothing is served for an empty address.
+func (m *MiFlora) serveMetrics(addr string) (func(), error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.metricsHandler())
+	srv := &http.Server{Handler: mux}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	_ = level.Info(m.logger).Log("msg", "serving metrics", "address", ln.Addr())
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			_ = level.Error(m.logger).Log("msg", "metrics server failed", "err", err)
+		}
+	}()
+	return func() {
+		_ = srv.Close()
+	}, nil
+}
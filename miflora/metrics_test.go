@@ -0,0 +1,107 @@
+package miflora
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/advertisements"
+)
+
+func TestParseErrorReason(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		reason string
+	}{
+		{err: advertisements.ErrFrameTooShort, reason: "frame_too_short"},
+		{err: fmt.Errorf("%w, length=3", advertisements.ErrMeasurementTooShort), reason: "measurement_too_short"},
+		{err: &advertisements.UnknownMeasurementError{ID: 0x100a}, reason: "unknown_measurement"},
+		{err: errors.New("something else"), reason: "other"},
+	} {
+		if exp, act := tc.reason, parseErrorReason(tc.err); exp != act {
+			t.Errorf("unexpected reason for %v exp: %v, act: %v", tc.err, exp, act)
+		}
+	}
+}
+
+func TestMetricsObserveParseError(t *testing.T) {
+	m := newMetrics(prometheus.NewRegistry())
+	m.observeParseError(&advertisements.UnknownMeasurementError{ID: 0x100a})
+
+	if exp, act := 1.0, testutil.ToFloat64(m.unknownMeasurementIDs.WithLabelValues("0x100a")); exp != act {
+		t.Errorf("unexpected unknown measurement count exp: %v, act: %v", exp, act)
+	}
+	if exp, act := 1.0, testutil.ToFloat64(m.parseErrors.WithLabelValues("unknown_measurement")); exp != act {
+		t.Errorf("unexpected parse error count exp: %v, act: %v", exp, act)
+	}
+}
+
+// scrapeMetrics returns the metrics served by the handler of the session
+// commands.
+func scrapeMetrics(t *testing.T, m *MiFlora) string {
+	t.Helper()
+	srv := httptest.NewServer(m.metricsHandler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsHandlerSessions(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.metrics.observeGATT(opDial, time.Now(), errors.New("req timeout"))
+	m.metrics.historyRecords.WithLabelValues("c4:7c:8d:aa:bb:cc").Inc()
+
+	body := scrapeMetrics(t, m)
+	for _, exp := range []string{
+		`flowercare_exporter_gatt_operations_total{operation="dial"} 1`,
+		`flowercare_exporter_gatt_operation_failures_total{operation="dial"} 1`,
+		`flowercare_exporter_history_records_downloaded_total{macaddress="c4:7c:8d:aa:bb:cc"} 1`,
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("metric %s not found in:\n%s", exp, body)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is served without address
+	stop, err := m.serveMetrics("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stop()
+
+	stop, err = m.serveMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stop()
+
+	if _, err := m.serveMetrics("invalid-address"); err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"os"
 	"sort"
 	"strings"
 	"sync"
@@ -22,10 +21,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	"github.com/simonswine/mi-flora-exporter/miflora/advertisements"
-	mcontext "github.com/simonswine/mi-flora-exporter/miflora/context"
+	"github.com/simonswine/mi-flora-exporter/miflora/alerting"
 	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	"github.com/simonswine/mi-flora-exporter/miflora/pipeline"
+	"github.com/simonswine/mi-flora-exporter/miflora/state"
 	mprom "github.com/simonswine/mi-flora-exporter/outputs/prometheus"
+	"github.com/simonswine/mi-flora-exporter/web"
 )
 
 const (
@@ -51,22 +52,60 @@ type MiFlora struct {
 	device  *linux.Device
 	stopCh  chan struct{}
 	sensors map[string]*Sensor
+
+	// adapter guards device and serializes scanning and establishing
+	// connections, the adapter only supports a single pending connection
+	adapter *adapterLock
+
+	registry *prometheus.Registry
+	metrics  *metrics
+
+	// openDevice is used to reopen the adapter after errors
+	openDevice func() (*linux.Device, error)
+
+	// processors are applied to results observed by the exporter
+	processors pipeline.Pipeline
+
+	// alerting evaluates rules against the state of the exporter
+	alerting *alerting.Engine
+
+	// retry configures retries of failed operations on sensors
+	retry RetryPolicy
+	// breaker skips sensors with too many consecutive failures
+	breaker *circuitBreaker
+
+	// batch configures the number of history records read per connection
+	batch BatchConfig
+
+	// clock tracks the drift of the sensor clocks
+	clock *ClockTracker
+
+	// events distributes the decoded advertisements to subscribers
+	events *broadcaster
+	// frames drops repeated advertisement frames
+	frames *frameTracker
+
+	// opts are overridden by values set in the context, see options
+	opts Options
 }
 
 type Sensor struct {
 	logger        log.Logger
-	device        *linux.Device
+	metrics       *metrics
 	advertisement ble.Advertisement
-
-	name           string
-	historyPointer *uint16
+	receivedAt    time.Time
+
+	name          string
+	historyCursor Cursor
+	historyRead   int
+	historyDone   bool
+	batchSize     int
+	// failures counts the consecutive failed sessions
+	failures int
 }
 
 func (s *Sensor) finished() bool {
-	if s.historyPointer == nil {
-		return false
-	}
-	return *s.historyPointer == 0
+	return s.historyDone || s.historyCursor.Done()
 }
 
 type HistoricMeasurement struct {
@@ -83,64 +122,102 @@ func (m *HistoricMeasurement) UnmarshalBinary(r io.Reader) error {
 	return m.Measurement.UnmarshalBinary(r)
 }
 
-func (s *Sensor) client(ctx context.Context) (*client, error) {
-	bleClient, err := s.device.Dial(ctx, s.advertisement.Addr())
+// Connect establishes a connection to the sensor with the given address,
+// failed attempts are retried according to the retry policy. The returned
+// client has to be closed after use.
+func (m *MiFlora) Connect(ctx context.Context, addr string) (*Client, error) {
+	if _, err := net.ParseMAC(addr); err != nil {
+		return nil, fmt.Errorf("invalid address '%s': %w", addr, err)
+	}
+	return m.connect(ctx, log.With(m.logger, "address", addr), ble.NewAddr(addr))
+}
+
+func (m *MiFlora) connect(ctx context.Context, logger log.Logger, addr ble.Addr) (c *Client, err error) {
+	err = m.retry.do(ctx, logger, m.metrics, opDial, func() error {
+		unlock, err := m.lockConn(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if m.device == nil {
+			return ErrAdapterUnavailable
+		}
+		c, err = dial(ctx, logger, m.device, m.metrics, addr, m.retry)
+		return err
+	})
+	return c, err
+}
+
+// currentDevice returns the adapter. It fails with ErrAdapterUnavailable,
+// while the adapter couldn't be reopened.
+func (m *MiFlora) currentDevice(ctx context.Context) (*linux.Device, error) {
+	unlock, err := m.lockConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if m.device == nil {
+		return nil, ErrAdapterUnavailable
+	}
+	return m.device, nil
+}
+
+func dial(ctx context.Context, logger log.Logger, device *linux.Device, metrics *metrics, addr ble.Addr, retry RetryPolicy) (*Client, error) {
+	start := time.Now()
+	bleClient, err := device.Dial(ctx, addr)
+	metrics.observeGATT(opDial, start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
-	c := &client{
-		client: bleClient,
+	c := &Client{
+		client:  bleClient,
+		metrics: metrics,
+		logger:  logger,
+		retry:   retry,
 	}
 
 	// this handles disconnected clients
 	go func() {
 		<-c.client.Disconnected()
-		_ = level.Debug(s.logger).Log("msg", "connection closed")
+		_ = level.Debug(logger).Log("msg", "connection closed")
 	}()
 
+	// failures are retried by dialing again, as retrying on a connection
+	// that failed to discover the profile rarely succeeds
+	start = time.Now()
 	p, err := c.client.DiscoverProfile(true)
+	metrics.observeGATT(opDiscoverProfile, start, err)
 	if err != nil {
+		if err := c.Close(); err != nil {
+			_ = level.Debug(logger).Log("msg", "error canceling connection", "error", err)
+		}
 		return nil, fmt.Errorf("failed to discover profile: %w", err)
 	}
 	var services []string
 	for _, service := range p.Services {
 		services = append(services, service.UUID.String())
 	}
-	_ = level.Debug(s.logger).Log("msg", "discovered profile", "services", strings.Join(services, ", "))
+	_ = level.Debug(logger).Log("msg", "discovered profile", "services", strings.Join(services, ", "))
 	c.profile = p
 
 	if err := c.client.Subscribe(
 		c.findCharacteristicByValueHandle(0x21),
 		false,
 		func(req []byte) {
-			_ = level.Debug(s.logger).Log("msg", "received notification 0x21", "data", string(req))
+			_ = level.Debug(logger).Log("msg", "received notification 0x21", "data", string(req))
 		},
 	); err != nil {
-		_ = level.Warn(s.logger).Log("msg", "error subscribing to notification", "error", err)
+		_ = level.Warn(logger).Log("msg", "error subscribing to notification", "error", err)
 	}
 
 	return c, nil
 }
 
-func isDeclaredSensor(ctx context.Context, addr string) (bool, string) {
-	for _, nameOverride := range mcontext.SensorsNamesFromContext(ctx) {
-		parts := strings.SplitN(nameOverride, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		if strings.EqualFold(addr, parts[1]) {
-			return true, parts[0]
-		}
-	}
-
-	return false, ""
-}
-
-func (m *MiFlora) newSensor(ctx context.Context, adv ble.Advertisement) *Sensor {
+func (m *MiFlora) newSensor(o ScanOptions, adv ble.Advertisement) *Sensor {
 	name := adv.LocalName()
 	addr := adv.Addr().String()
 
-	if declared, overrideName := isDeclaredSensor(ctx, addr); declared {
+	if overrideName, declared := o.sensorName(addr); declared {
 		name = overrideName
 	}
 
@@ -150,19 +227,56 @@ func (m *MiFlora) newSensor(ctx context.Context, adv ble.Advertisement) *Sensor
 	}
 	return &Sensor{
 		logger:        logger,
-		device:        m.device,
+		metrics:       m.metrics,
 		advertisement: adv,
+		receivedAt:    time.Now(),
 		name:          name,
 	}
 }
 
-func New(device *linux.Device) *MiFlora {
-	return &MiFlora{
-		logger:  log.NewNopLogger(),
-		device:  device,
-		sensors: make(map[string]*Sensor),
-		stopCh:  make(chan struct{}),
+// New returns a MiFlora using the given adapter, the options are applied on
+// top of DefaultOptions.
+func New(device *linux.Device, opts ...Option) (*MiFlora, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	clock := o.Sessions.Clock
+	if clock == nil {
+		clock = &ClockTracker{sensors: make(map[string]*clockState)}
 	}
+
+	registry := prometheus.NewRegistry()
+	return &MiFlora{
+		logger:     log.NewNopLogger(),
+		device:     device,
+		sensors:    make(map[string]*Sensor),
+		stopCh:     make(chan struct{}),
+		adapter:    newAdapterLock(),
+		openDevice: o.DeviceOpener,
+		processors: o.Processors,
+		alerting:   o.Alerting,
+		retry:      o.Sessions.Retry,
+		batch:      o.History.Batch,
+		clock:      clock,
+		breaker:    newCircuitBreaker(o.Sessions.CircuitBreaker.Failures, o.Sessions.CircuitBreaker.Cooldown),
+		registry:   registry,
+		metrics:    newMetrics(registry),
+		events:     newBroadcaster(),
+		frames:     newFrameTracker(),
+		opts:       o,
+	}, nil
+}
+
+// Options returns the options of the MiFlora.
+func (m *MiFlora) Options() Options {
+	return m.opts
 }
 
 func (m *MiFlora) WithLogger(l log.Logger) *MiFlora {
@@ -170,141 +284,254 @@ func (m *MiFlora) WithLogger(l log.Logger) *MiFlora {
 	return m
 }
 
+// Processors returns the processors applied to results.
+func (m *MiFlora) Processors() pipeline.Pipeline {
+	return m.processors
+}
+
 const (
 	deviceName    = "Flower care"
 	addressPrefix = "C4:7C:8D"
 )
 
+const (
+	scanRestartBackoffMin = time.Second
+	scanRestartBackoffMax = time.Minute
+)
+
 func (m *MiFlora) Scan(ctx context.Context) error {
 	_, err := m.doScan(ctx)
 	return err
 }
 
 func (m *MiFlora) HistoricValues(ctx context.Context) error {
-	resultCh := mcontext.ResultChannelFromContext(ctx)
+	opts, err := m.options(ctx)
+	if err != nil {
+		return err
+	}
+	stop, err := m.serveMetrics(opts.Sessions.MetricsListenAddress)
+	if err != nil {
+		return err
+	}
+	defer stop()
 
 	sensors, err := m.doScan(ctx)
 	if err != nil {
 		return err
 	}
+	defer m.saveClock()
 
 	for {
-		var nextSensors []*Sensor
-		for _, s := range sensors {
-			if err := func(s *Sensor) error {
-				ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-				defer cancel()
-
-				c, err := s.client(ctx)
-				if err != nil {
-					_ = level.Warn(s.logger).Log("msg", "error connecting to sensor", "error", err)
-					return nil
-				}
-				defer func() {
-					if err := c.client.CancelConnection(); err != nil {
-						_ = level.Warn(s.logger).Log("msg", "error canceling connection", "error", err)
-					}
-				}()
-
-				timeDiff, err := c.DeviceTimeDiff()
-				if err != nil {
-					_ = level.Warn(s.logger).Log("msg", "error reading device time", "error", err)
-					return nil
-				}
-
-				historyLength, err := c.HistoryLength()
-				if err != nil {
-					_ = level.Warn(s.logger).Log("msg", "error querying history length", "error", err)
-					return nil
-				}
-				_ = level.Debug(s.logger).Log("msg", "read length of history", "length", historyLength)
-
-				// restore pointer
-				if s.historyPointer != nil {
-					historyLength = *s.historyPointer - 1
-				}
-
-				for i := int32(historyLength); i >= 0; i-- {
-					pos := uint16(i)
-					hm, err := c.HistoryMeasurement(pos)
-					if err != nil {
-						_ = level.Warn(s.logger).Log("msg", "error querying history measurement", "position", i, "error", err)
-						return nil
-					}
-
-					timestamp := hm.DeviceTime.Add(timeDiff)
-					if resultCh != nil {
-						select {
-						case <-ctx.Done():
-							return ctx.Err()
-						case resultCh <- &model.Result{
-							Name:        s.name,
-							Address:     s.advertisement.Addr().String(),
-							Timestamp:   &timestamp,
-							Measurement: &hm.Measurement,
-						}:
-						}
-					}
-
-					// store the position
-					s.historyPointer = &pos
-
-					_ = hm.LogWith(level.Debug(s.logger)).Log(
-						"msg", "historic measurement successful",
-						"pos", pos,
-						"device_time", timestamp.Format(time.RFC3339),
-					)
-
-					// limit batch size at 50
-					if historyLength-pos > 50 {
-						return nil
-					}
-				}
-				return nil
-
-			}(s); err != nil {
-				return err
-			}
-			if !s.finished() {
-				nextSensors = append(nextSensors, s)
-			}
+		if err := m.runSessions(ctx, sensors, m.historySession); err != nil {
+			return err
 		}
-		if len(nextSensors) == 0 {
+
+		sensors = m.pendingSensors(sensors)
+		if len(sensors) == 0 {
 			break
 		}
-		sensors = nextSensors
 	}
 	return nil
 }
 
-func (m *MiFlora) Exporter(ctx context.Context) error {
-	sensorsCh := make(chan *Sensor)
+// pendingSensors returns the sensors, whose history hasn't been read
+// completely. Sensors are given up on once the circuit breaker opens or, if
+// it is disabled, after as many consecutive failed sessions as the retry
+// policy allows attempts.
+func (m *MiFlora) pendingSensors(sensors []*Sensor) []*Sensor {
+	maxFailures := m.retry.Attempts
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
 
-	metrics := mprom.NewMetrics(prometheus.DefaultRegisterer)
+	var pending []*Sensor
+	for _, s := range sensors {
+		if s.finished() {
+			continue
+		}
+		if !m.breaker.allow(s.advertisement.Addr().String()) ||
+			(!m.breaker.enabled() && s.failures >= maxFailures) {
+			_ = level.Warn(s.logger).Log("msg", "giving up on sensor after consecutive failures", "consecutive_failures", s.failures)
+			continue
+		}
+		pending = append(pending, s)
+	}
+	return pending
+}
+
+// historySession reads the next batch of historic measurements from the
+// sensor.
+func (m *MiFlora) historySession(ctx context.Context, s *Sensor) (results []*model.Result, err error) {
+	c, err := m.connect(ctx, s.logger, s.advertisement.Addr())
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to sensor: %w", err)
+	}
+	defer func() {
+		if err := c.Close(); err != nil {
+			_ = level.Warn(s.logger).Log("msg", "error canceling connection", "error", err)
+		}
+	}()
+
+	if err := c.do(ctx, opDeviceTime, func() error {
+		o, err := c.DeviceTime()
+		if err == nil {
+			m.observeClock(s.logger, s.advertisement.Addr().String(), o)
+		}
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("error reading device time: %w", err)
+	}
+
+	batchSize := s.batchSize
+	if batchSize == 0 {
+		batchSize = m.batch.size(s.name, s.advertisement.Addr().String())
+	}
+	o, err := m.options(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := o.History
+	since, until, maxRecords := opts.Since, opts.Until, opts.MaxRecords
+
+	var read int
+	start := time.Now()
+	defer func() {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		s.batchSize = m.observeBatch(s, batchSize, read, time.Since(start), err)
+	}()
+
+	it := c.History(ctx, s.historyCursor)
+	for read < batchSize {
+		if maxRecords > 0 && s.historyRead >= maxRecords {
+			_ = level.Debug(s.logger).Log("msg", "read maximum number of history records", "records", s.historyRead)
+			s.historyDone = true
+			return results, nil
+		}
+
+		if !it.Next() {
+			break
+		}
+		if read == 0 {
+			_ = level.Debug(s.logger).Log("msg", "read length of history", "length", it.Length())
+		}
+		hm := it.Measurement()
+		pos := it.Cursor().Index
+
+		read++
+		s.historyRead++
+
+		// store the position
+		s.historyCursor = it.Cursor()
+		s.metrics.historyRecords.WithLabelValues(s.advertisement.Addr().String()).Inc()
+
+		timestamp, _ := m.clock.WallTime(s.advertisement.Addr().String(), hm.DeviceTime.Unix())
+		if !since.IsZero() && timestamp.Before(since) {
+			// records are read newest first, so all remaining records are
+			// older
+			_ = level.Debug(s.logger).Log("msg", "reached history records before since", "pos", pos, "device_time", timestamp.Format(time.RFC3339))
+			s.historyDone = true
+			return results, nil
+		}
+		if until.IsZero() || !timestamp.After(until) {
+			results = append(results, &model.Result{
+				Name:        s.name,
+				Address:     s.advertisement.Addr().String(),
+				Timestamp:   &timestamp,
+				Measurement: &hm.Measurement,
+			})
+		}
+
+		_ = hm.LogWith(level.Debug(s.logger)).Log(
+			"msg", "historic measurement successful",
+			"pos", pos,
+			"device_time", timestamp.Format(time.RFC3339),
+		)
+	}
+	if err := it.Err(); err != nil {
+		if errors.Is(err, ErrHistoryChanged) {
+			// resuming would read other records than expected
+			s.historyDone = true
+		}
+		return results, fmt.Errorf("error reading history: %w", err)
+	}
+	if read < batchSize {
+		// the oldest record has been read
+		s.historyDone = true
+	}
+	return results, nil
+}
+
+func (m *MiFlora) Exporter(ctx context.Context) error {
+	opts, err := m.options(ctx)
+	if err != nil {
+		return err
+	}
+	units := opts.Units
+	collector := mprom.NewCollector().WithTimestamps(opts.Exporter.MetricsTimestamps).WithUnits(units)
+	registry := m.registry
+
+	// the registry outlives the exporter, so collectors are unregistered
+	// again once it returns
+	var registered []prometheus.Collector
+	defer func() {
+		for _, c := range registered {
+			registry.Unregister(c)
+		}
+	}()
+	register := func(c prometheus.Collector, what string) error {
+		if err := registry.Register(c); err != nil {
+			return fmt.Errorf("failed to register metrics of %s: %w", what, err)
+		}
+		registered = append(registered, c)
+		return nil
+	}
+	if err := register(collector, "exporter"); err != nil {
+		return err
+	}
+	for _, p := range m.processors {
+		if c, ok := p.(prometheus.Collector); ok {
+			if err := register(c, "processor"); err != nil {
+				return err
+			}
+		}
+	}
+	if m.alerting != nil {
+		if err := register(m.alerting, "alerting"); err != nil {
+			return err
+		}
+	}
+	store := state.New().WithLabels(mprom.Labels).WithUnits(units)
+	health := newHealth(opts.Exporter.ReadyWindow)
+	_, err = m.currentDevice(ctx)
+	health.setDeviceOpen(err == nil)
 	metricsPath := "/metrics"
 
 	// Expose the registered metrics via HTTP.
 	mux := http.NewServeMux()
 	mux.Handle(metricsPath, promhttp.HandlerFor(
-		prometheus.DefaultGatherer,
+		registry,
 		promhttp.HandlerOpts{
 			// Opt into OpenMetrics to support exemplars.
 			EnableOpenMetrics: true,
 		},
 	))
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte(`<html>
-			<head><title>Mi Flora Exporter</title></head>
-			<body>
-			<h1>Mi Flora Exporter</h1>
-			<p><a href="` + metricsPath + `">Metrics</a></p>
-			</body>
-			</html>`))
-	})
+	mux.Handle(probePath, m.probeHandler(opts, store))
+	mux.Handle(apiSensorsPath, apiSensorsHandler(store))
+	mux.Handle(apiSensorsPath+"/", apiSensorsHandler(store))
+	mux.Handle(apiStreamPath, apiStreamHandler(m.events))
+	if m.alerting != nil {
+		mux.Handle(apiAlertsPath, apiAlertsHandler(m.alerting))
+	}
+	mux.HandleFunc(healthyPath, health.healthyHandler)
+	mux.HandleFunc(readyPath, health.readyHandler)
+
+	mux.Handle("/", web.Handler())
 
 	srv := &http.Server{
-		Addr:    mcontext.BindAddressFromContext(ctx),
+		Addr:    opts.Exporter.BindAddress,
 		Handler: mux,
 	}
 
@@ -314,121 +541,255 @@ func (m *MiFlora) Exporter(ctx context.Context) error {
 	}
 	_ = level.Info(m.logger).Log("msg", "starting exporter", "address", ln.Addr())
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	srvErrCh := make(chan error, 1)
 	go func() {
-		if err := srv.Serve(ln); err != nil {
-			_ = level.Error(m.logger).Log("err", err)
-			os.Exit(1)
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			_ = level.Error(m.logger).Log("msg", "http server failed", "err", err)
+			srvErrCh <- err
+			cancel()
 		}
 	}()
+	defer srv.Close()
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	if m.alerting != nil {
+		go m.alerting.WithLogger(log.With(m.logger, "component", "alerting")).Run(ctx, store)
+	}
 
-	go func() {
-		for s := range sensorsCh {
-			for _, serviceData := range s.advertisement.ServiceData() {
-				data, err := advertisements.New(serviceData.Data)
-				if err != nil {
-					_ = level.Error(s.logger).Log("err", err)
-					continue
-				}
-				if !data.HasMeasurement() {
-					continue
-				}
-				measurement, err := data.Measurement()
-				if err != nil {
-					_ = level.Error(s.logger).Log("err", err)
-					continue
-				}
-				rssi := s.advertisement.RSSI()
-				labelValues := []string{s.advertisement.Addr().String(), s.name}
-
-				metrics.ObserveMeasurement(measurement, labelValues...)
-				metrics.ObserveRSSI(float64(rssi), labelValues...)
-				_ = level.Info(measurement.LogWith(s.logger)).Log("msg", "sensor advertisement received", "rssi", rssi)
+	m.SubscribeFunc(ctx, Filter{}, m.exporterSubscriber(collector, store))
+
+	err = m.listen(ctx, health, func(results []*model.Result) {
+		for _, result := range results {
+			collector.ObserveResult(result)
+			store.ObserveResult(result)
+		}
+	})
+
+	select {
+	case err := <-srvErrCh:
+		return err
+	default:
+	}
+	return err
+}
+
+// exporterSubscriber updates the metrics and the store of the exporter with
+// the received advertisements. The results of the processors are observed
+// by the Exporter separately.
+func (m *MiFlora) exporterSubscriber(collector *mprom.Collector, store *state.Store) func(*model.Advertisement) {
+	return func(adv *model.Advertisement) {
+		logger := log.With(m.logger, "address", adv.Address)
+		if len(adv.Name) > 0 {
+			logger = log.With(logger, "name", adv.Name)
+		}
+		collector.ObserveRSSI(adv.Address, adv.Name, adv.Timestamp, float64(adv.RSSI))
+		store.ObserveAdvertisement(adv.Address, adv.Name, adv.Timestamp, adv.RSSI, adv.FrameCounter)
+
+		if adv.Measurement == nil {
+			m.metrics.advertisementsReceived.WithLabelValues(advertisementTypeNone, adv.Address).Inc()
+			return
+		}
+		for field := range adv.Measurement.Values() {
+			m.metrics.advertisementsReceived.WithLabelValues(field, adv.Address).Inc()
+		}
+		_ = level.Info(adv.Measurement.LogWith(logger)).Log("msg", "sensor advertisement received", "rssi", adv.RSSI)
+	}
+}
+
+// scanWithRecovery scans for advertisements until the context is canceled.
+// If the scan fails, the adapter is reopened and the scan restarted.
+func (m *MiFlora) scanWithRecovery(ctx context.Context, health *health, sensorsCh chan *Sensor) error {
+	backoff := scanRestartBackoffMin
+	for {
+		start := time.Now()
+		health.setScanning(true)
+		err := m.doScanReal(ctx, sensorsCh)
+		health.setScanning(false)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if m.openDevice == nil {
+			return err
+		}
+
+		// reset backoff after the scan has been running for a while
+		if time.Since(start) > scanRestartBackoffMax {
+			backoff = scanRestartBackoffMin
+		}
+
+		_ = level.Warn(m.logger).Log("msg", "scan stopped, reopening adapter", "backoff", backoff, "error", err)
+		health.setDeviceOpen(false)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > scanRestartBackoffMax {
+				backoff = scanRestartBackoffMax
 			}
+
+			if err := m.reopenDevice(ctx); err != nil {
+				m.metrics.hciErrors.Inc()
+				_ = level.Warn(m.logger).Log("msg", "failed to reopen adapter", "backoff", backoff, "error", err)
+				continue
+			}
+			break
 		}
-	}()
 
-	if err := m.doScanReal(ctx, sensorsCh); err != nil {
+		health.setDeviceOpen(true)
+		m.metrics.scanRestarts.Inc()
+		_ = level.Info(m.logger).Log("msg", "adapter reopened, restarting scan")
+	}
+}
+
+// reopenDevice closes the current adapter and opens a new one. The device
+// is only set once the new adapter has been opened, until then uses of the
+// adapter fail with ErrAdapterUnavailable.
+func (m *MiFlora) reopenDevice(ctx context.Context) error {
+	unlock, err := m.lockConn(ctx)
+	if err != nil {
 		return err
 	}
+	defer unlock()
+
+	if m.device != nil {
+		if err := m.device.Stop(); err != nil {
+			_ = level.Debug(m.logger).Log("msg", "error stopping adapter", "error", err)
+		}
+		// a stopped adapter can't be used anymore
+		m.device = nil
+	}
 
+	d, err := m.openDevice()
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return ErrAdapterUnavailable
+	}
+	m.device = d
 	return nil
 }
 
 func (m *MiFlora) Realtime(ctx context.Context) error {
-	resultCh := mcontext.ResultChannelFromContext(ctx)
+	opts, err := m.options(ctx)
+	if err != nil {
+		return err
+	}
+	stop, err := m.serveMetrics(opts.Sessions.MetricsListenAddress)
+	if err != nil {
+		return err
+	}
+	defer stop()
 
 	sensors, err := m.doScan(ctx)
 	if err != nil {
 		return err
 	}
+	defer m.saveClock()
 
-	for _, s := range sensors {
-		if err := func(s *Sensor) error {
-			ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-			defer cancel()
+	return m.runSessions(ctx, sensors, m.realtimeSession)
+}
 
-			c, err := s.client(ctx)
-			if err != nil {
-				_ = level.Warn(s.logger).Log("msg", "error connecting to sensor", "error", err)
-				return nil
-			}
+// realtimeSession reads the firmware and the current measurement from the
+// sensor.
+func (m *MiFlora) realtimeSession(ctx context.Context, s *Sensor) ([]*model.Result, error) {
+	c, err := m.connect(ctx, s.logger, s.advertisement.Addr())
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to sensor: %w", err)
+	}
+	defer func() {
+		if err := c.Close(); err != nil {
+			_ = level.Warn(s.logger).Log("msg", "error canceling connection", "error", err)
+		}
+	}()
 
-			f, err := c.Firmware()
-			if err != nil {
-				_ = level.Warn(s.logger).Log("msg", "error querying firmware", "error", err)
-				return nil
-			}
-			_ = level.Info(s.logger).Log("msg", "connected", "version", f.Version, "battery", f.Battery)
+	var f *model.Firmware
+	if err := c.do(ctx, opFirmware, func() (err error) {
+		f, err = c.Firmware()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("error querying firmware: %w", err)
+	}
+	_ = level.Info(s.logger).Log("msg", "connected", "version", f.Version, "battery", f.Battery)
 
-			m, err := c.Measurement()
-			if err != nil {
-				_ = level.Warn(s.logger).Log("msg", "error querying measurement", "error", err)
-				return nil
-			}
-			if resultCh != nil {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case resultCh <- &model.Result{
-					Name:        s.name,
-					Address:     s.advertisement.Addr().String(),
-					Firmware:    f,
-					Measurement: m,
-				}:
-				}
-			}
-			_ = m.LogWith(level.Info(s.logger)).Log(
-				"msg", "measurement successful",
-			)
+	if o, err := c.DeviceTime(); err != nil {
+		_ = level.Debug(s.logger).Log("msg", "error reading device time", "error", err)
+	} else {
+		m.observeClock(s.logger, s.advertisement.Addr().String(), o)
+	}
 
-			return nil
-		}(s); err != nil {
-			return err
-		}
+	var measurement *model.Measurement
+	if err := c.do(ctx, opMeasurement, func() (err error) {
+		measurement, err = c.Measurement()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("error querying measurement: %w", err)
 	}
-	return nil
+	_ = measurement.LogWith(level.Info(s.logger)).Log(
+		"msg", "measurement successful",
+	)
+
+	return []*model.Result{{
+		Name:        s.name,
+		Address:     s.advertisement.Addr().String(),
+		Firmware:    f,
+		Measurement: measurement,
+	}}, nil
 }
 
 func (m *MiFlora) doScanReal(ctx context.Context, sensorsCh chan *Sensor) error {
-	declaredSensorNames := len(mcontext.SensorsNamesFromContext(ctx))
+	o, err := m.options(ctx)
+	if err != nil {
+		return err
+	}
+	opts := o.Scan
 
 	handler := func(a ble.Advertisement) {
 		if !isMiraFloraDevice(a) {
 			return
 		}
-		if declaredSensorNames > 0 {
-			if ok, _ := isDeclaredSensor(ctx, a.Addr().String()); !ok {
+		if len(opts.SensorNames) > 0 {
+			if _, ok := opts.sensorName(a.Addr().String()); !ok {
 				return
 			}
 		}
-		sensorsCh <- m.newSensor(ctx, a)
+		sensorsCh <- m.newSensor(opts, a)
+	}
+
+	for {
+		scanCtx, unlock, err := m.adapter.lockScan(ctx)
+		if err != nil {
+			return err
+		}
+		err = m.scanDevice(scanCtx, opts, handler)
+		unlock()
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		_ = level.Debug(m.logger).Log("msg", "resuming scan paused for a connection")
+	}
+}
+
+// scanDevice scans until the context is canceled, it requires the adapter
+// to be locked.
+func (m *MiFlora) scanDevice(ctx context.Context, opts ScanOptions, handler ble.AdvHandler) error {
+	if m.device == nil {
+		return ErrAdapterUnavailable
 	}
 
 	// set passive mode if required
-	if mcontext.ScanPassiveFromContext(ctx) {
+	if opts.Passive {
 		if err := m.device.HCI.Send(&cmd.LESetScanParameters{
 			LEScanType:           0x00,   // 0x00: passive
 			LEScanInterval:       0x4000, // 0x0004 - 0x4000; N * 0.625msec
@@ -436,6 +797,7 @@ func (m *MiFlora) doScanReal(ctx context.Context, sensorsCh chan *Sensor) error
 			OwnAddressType:       0x00,   // 0x00: public
 			ScanningFilterPolicy: 0x00,   // 0x00: accept all
 		}, nil); err != nil {
+			m.metrics.hciErrors.Inc()
 			return err
 		}
 	}
@@ -444,9 +806,9 @@ func (m *MiFlora) doScanReal(ctx context.Context, sensorsCh chan *Sensor) error
 	if err := m.device.Scan(ctx, true, handler); err != nil &&
 		!errors.Is(err, context.DeadlineExceeded) &&
 		!errors.Is(err, context.Canceled) {
+		m.metrics.hciErrors.Inc()
 		return fmt.Errorf("failed to scan for sensors: %w", err)
 	}
-	close(sensorsCh)
 
 	return nil
 }
@@ -454,13 +816,18 @@ func (m *MiFlora) doScanReal(ctx context.Context, sensorsCh chan *Sensor) error
 func (m *MiFlora) doScan(ctx context.Context) ([]*Sensor, error) {
 	sensorsCh := make(chan *Sensor)
 
-	ctx, cancel := context.WithTimeout(ctx, mcontext.ScanTimeoutFromContext(ctx))
+	o, err := m.options(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := o.Scan
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
 	defer cancel()
 
 	var sensors SensorSlice
-	expectedSensors := mcontext.ExpectedSensorsFromContext(ctx)
+	expectedSensors := opts.ExpectedSensors
 
-	declaredSensorNames := len(mcontext.SensorsNamesFromContext(ctx))
+	declaredSensorNames := len(opts.SensorNames)
 	if declaredSensorNames > 0 {
 		expectedSensors = int64(declaredSensorNames)
 	}
@@ -481,7 +848,9 @@ func (m *MiFlora) doScan(ctx context.Context) ([]*Sensor, error) {
 		}
 	}()
 
-	if err := m.doScanReal(ctx, sensorsCh); err != nil {
+	err = m.doScanReal(ctx, sensorsCh)
+	close(sensorsCh)
+	if err != nil {
 		return nil, err
 	}
 
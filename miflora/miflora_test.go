@@ -13,7 +13,9 @@ func (f *fakeAddr) String() string {
 }
 
 type fakeAdvertisement struct {
-	addr *fakeAddr
+	addr        *fakeAddr
+	rssi        int
+	serviceData []ble.ServiceData
 }
 
 func (f *fakeAdvertisement) LocalName() string {
@@ -25,7 +27,7 @@ func (f *fakeAdvertisement) ManufacturerData() []byte {
 }
 
 func (f *fakeAdvertisement) ServiceData() []ble.ServiceData {
-	panic("not implemented") // TODO: Implement
+	return f.serviceData
 }
 
 func (f *fakeAdvertisement) Services() []ble.UUID {
@@ -49,7 +51,7 @@ func (f *fakeAdvertisement) SolicitedService() []ble.UUID {
 }
 
 func (f *fakeAdvertisement) RSSI() int {
-	return 66
+	return f.rssi
 }
 
 func (f *fakeAdvertisement) Addr() ble.Addr {
@@ -60,6 +62,7 @@ func newFakeAdvertisement(s string) *fakeAdvertisement {
 	addr := fakeAddr(s)
 	return &fakeAdvertisement{
 		addr: &addr,
+		rssi: 66,
 	}
 
 }
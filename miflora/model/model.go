@@ -16,6 +16,79 @@ type Result struct {
 	Timestamp   *time.Time   `json:"timestamp,omitempty"`
 	Firmware    *Firmware    `json:"firmware,omitempty"`
 	Measurement *Measurement `json:"measurement,omitempty"`
+	// RawMeasurement is the measurement before calibration.
+	RawMeasurement *Measurement `json:"raw_measurement,omitempty"`
+
+	Species    string      `json:"species,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	Watering   *WateringEvent `json:"watering,omitempty"`
+	DailyLight *DailyLight    `json:"daily_light,omitempty"`
+
+	MoistureForecast *MoistureForecast `json:"moisture_forecast,omitempty"`
+}
+
+// WateringEvent is a sharp increase of the soil moisture.
+type WateringEvent struct {
+	Timestamp      time.Time `json:"timestamp"`
+	MoistureBefore float64   `json:"moisture_before"`
+	MoistureAfter  float64   `json:"moisture_after"`
+
+	// WateringsOnDay is the number of waterings detected on the same day.
+	WateringsOnDay int `json:"waterings_on_day"`
+}
+
+// DailyLight summarises the light a plant received on a single day.
+type DailyLight struct {
+	Date string `json:"date"`
+	// DLI is the daily light integral in mol/m²/day.
+	DLI float64 `json:"dli"`
+	// LightHours is the time in hours the brightness was above a threshold.
+	LightHours float64 `json:"light_hours"`
+	// Coverage is the fraction of the day covered by measurements.
+	Coverage float64 `json:"coverage"`
+}
+
+// MoistureForecast predicts when the moisture falls below a threshold.
+type MoistureForecast struct {
+	Threshold float64 `json:"threshold"`
+	// Rate is the change of moisture in percentage points per hour.
+	Rate              float64   `json:"rate"`
+	ThresholdCrossing time.Time `json:"threshold_crossing"`
+}
+
+// States of a condition.
+const (
+	ConditionTooLow  = "too_low"
+	ConditionOK      = "ok"
+	ConditionTooHigh = "too_high"
+)
+
+// ConditionStates contains all states a condition can be in.
+var ConditionStates = []string{ConditionTooLow, ConditionOK, ConditionTooHigh}
+
+// Condition is the state of a measured value compared to the thresholds
+// preferred by the plant.
+type Condition struct {
+	Dimension string   `json:"dimension"`
+	State     string   `json:"state"`
+	Value     float64  `json:"value"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+}
+
+// Advertisement is a decoded advertisement frame received from a sensor.
+type Advertisement struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+
+	Timestamp     time.Time    `json:"timestamp"`
+	RSSI          int          `json:"rssi"`
+	ProductID     uint16       `json:"product_id"`
+	FrameCounter  uint8        `json:"frame_counter"`
+	Capabilities  *uint8       `json:"capabilities,omitempty"`
+	MeasurementID *uint16      `json:"measurement_id,omitempty"`
+	Measurement   *Measurement `json:"measurement,omitempty"`
 }
 
 type Firmware struct {
@@ -62,6 +135,14 @@ func (c Conductivity) MarshalJSON() ([]byte, error) {
 	return []byte(c.String()), nil
 }
 
+// Names of the values contained in a measurement.
+const (
+	FieldTemperature  = "temperature"
+	FieldMoisture     = "moisture"
+	FieldBrightness   = "brightness"
+	FieldConductivity = "conductivity"
+)
+
 type Measurement struct {
 	Temperature  *Temperature  `json:"temperature"`
 	Moisture     *uint8        `json:"moisture"`
@@ -69,6 +150,25 @@ type Measurement struct {
 	Conductivity *Conductivity `json:"conductivity"`
 }
 
+// Values returns all values set in the measurement keyed by their field
+// name.
+func (m *Measurement) Values() map[string]float64 {
+	values := make(map[string]float64, 4)
+	if m.Temperature != nil {
+		values[FieldTemperature] = m.Temperature.Value()
+	}
+	if m.Moisture != nil {
+		values[FieldMoisture] = float64(*m.Moisture)
+	}
+	if m.Brightness != nil {
+		values[FieldBrightness] = float64(*m.Brightness)
+	}
+	if m.Conductivity != nil {
+		values[FieldConductivity] = m.Conductivity.Value()
+	}
+	return values
+}
+
 func (m *Measurement) LogWith(l log.Logger) log.Logger {
 	if m.Temperature != nil {
 		l = log.With(l, "temperature", m.Temperature)
@@ -0,0 +1,291 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// TemperatureUnit is a unit of the temperature.
+type TemperatureUnit string
+
+// Units of the temperature.
+const (
+	Celsius    TemperatureUnit = "celsius"
+	Fahrenheit TemperatureUnit = "fahrenheit"
+	Kelvin     TemperatureUnit = "kelvin"
+)
+
+// ConductivityUnit is a unit of the conductivity.
+type ConductivityUnit string
+
+// Units of the conductivity.
+const (
+	SiemensPerMeter           ConductivityUnit = "siemens_per_meter"
+	MicrosiemensPerCentimeter ConductivityUnit = "microsiemens_per_centimeter"
+)
+
+// BrightnessUnit is a unit of the brightness.
+type BrightnessUnit string
+
+// Units of the brightness.
+const (
+	Lux         BrightnessUnit = "lux"
+	FootCandles BrightnessUnit = "foot_candles"
+)
+
+// UnitPercent is the unit of the moisture.
+const UnitPercent = "percent"
+
+// luxPerFootCandle is the number of lux in a foot-candle.
+const luxPerFootCandle = 10.763910417
+
+// In returns the temperature in the unit.
+func (t Temperature) In(u TemperatureUnit) float64 {
+	return Units{Temperature: u}.Convert(FieldTemperature, t.Value())
+}
+
+// In returns the conductivity in the unit.
+func (c Conductivity) In(u ConductivityUnit) float64 {
+	if u == MicrosiemensPerCentimeter {
+		// the raw value is in µS/cm
+		return float64(c)
+	}
+	return c.Value()
+}
+
+// BrightnessIn returns a brightness in lux in the unit.
+func BrightnessIn(lux float64, u BrightnessUnit) float64 {
+	if u == FootCandles {
+		return lux / luxPerFootCandle
+	}
+	return lux
+}
+
+// Units selects the units values are exposed in.
+type Units struct {
+	Temperature  TemperatureUnit  `json:"temperature"`
+	Conductivity ConductivityUnit `json:"conductivity"`
+	Brightness   BrightnessUnit   `json:"brightness"`
+}
+
+// DefaultUnits returns the units used by Measurement.Values.
+func DefaultUnits() Units {
+	return Units{
+		Temperature:  Celsius,
+		Conductivity: SiemensPerMeter,
+		Brightness:   Lux,
+	}
+}
+
+// ParseUnits validates the units, empty units are replaced by the default.
+func ParseUnits(temperature, conductivity, brightness string) (Units, error) {
+	u := DefaultUnits()
+
+	switch v := TemperatureUnit(temperature); v {
+	case "":
+	case Celsius, Fahrenheit, Kelvin:
+		u.Temperature = v
+	default:
+		return u, fmt.Errorf("unknown temperature unit '%s'", temperature)
+	}
+
+	switch v := ConductivityUnit(conductivity); v {
+	case "":
+	case SiemensPerMeter, MicrosiemensPerCentimeter:
+		u.Conductivity = v
+	default:
+		return u, fmt.Errorf("unknown conductivity unit '%s'", conductivity)
+	}
+
+	switch v := BrightnessUnit(brightness); v {
+	case "":
+	case Lux, FootCandles:
+		u.Brightness = v
+	default:
+		return u, fmt.Errorf("unknown brightness unit '%s'", brightness)
+	}
+
+	return u, nil
+}
+
+// Unit returns the unit of a measurement field.
+func (u Units) Unit(field string) string {
+	switch field {
+	case FieldTemperature:
+		return string(u.Temperature)
+	case FieldConductivity:
+		return string(u.Conductivity)
+	case FieldBrightness:
+		return string(u.Brightness)
+	case FieldMoisture:
+		return UnitPercent
+	}
+	return ""
+}
+
+// Map returns the units of all measurement fields.
+func (u Units) Map() map[string]string {
+	return map[string]string{
+		FieldTemperature:  u.Unit(FieldTemperature),
+		FieldMoisture:     u.Unit(FieldMoisture),
+		FieldBrightness:   u.Unit(FieldBrightness),
+		FieldConductivity: u.Unit(FieldConductivity),
+	}
+}
+
+// Convert converts a value of a measurement field from the default units to
+// the units.
+func (u Units) Convert(field string, v float64) float64 {
+	switch field {
+	case FieldTemperature:
+		switch u.Temperature {
+		case Fahrenheit:
+			return v*9/5 + 32
+		case Kelvin:
+			return v + 273.15
+		}
+	case FieldConductivity:
+		if u.Conductivity == MicrosiemensPerCentimeter {
+			// 1 S/m = 10000 µS/cm
+			return v * 10000
+		}
+	case FieldBrightness:
+		return BrightnessIn(v, u.Brightness)
+	}
+	return v
+}
+
+// ConvertFrom converts a value of a measurement field from the units to the
+// default units.
+func (u Units) ConvertFrom(field string, v float64) float64 {
+	switch field {
+	case FieldTemperature:
+		switch u.Temperature {
+		case Fahrenheit:
+			return (v - 32) * 5 / 9
+		case Kelvin:
+			return v - 273.15
+		}
+	case FieldConductivity:
+		if u.Conductivity == MicrosiemensPerCentimeter {
+			return v / 10000
+		}
+	case FieldBrightness:
+		if u.Brightness == FootCandles {
+			return v * luxPerFootCandle
+		}
+	}
+	return v
+}
+
+func convertCondition(c Condition, convert func(field string, v float64) float64) Condition {
+	c.Value = convert(c.Dimension, c.Value)
+	if c.Min != nil {
+		v := convert(c.Dimension, *c.Min)
+		c.Min = &v
+	}
+	if c.Max != nil {
+		v := convert(c.Dimension, *c.Max)
+		c.Max = &v
+	}
+	return c
+}
+
+// ConvertCondition converts the values of the condition to the units.
+func (u Units) ConvertCondition(c Condition) Condition {
+	return convertCondition(c, u.Convert)
+}
+
+// ConvertConditionFrom converts the values of the condition from the units to
+// the default units.
+func (u Units) ConvertConditionFrom(c Condition) Condition {
+	return convertCondition(c, u.ConvertFrom)
+}
+
+// ValuesIn returns all values set in the measurement keyed by their field
+// name in the units.
+func (m *Measurement) ValuesIn(u Units) map[string]float64 {
+	values := m.Values()
+	if m.Temperature != nil {
+		values[FieldTemperature] = m.Temperature.In(u.Temperature)
+	}
+	if m.Brightness != nil {
+		values[FieldBrightness] = BrightnessIn(float64(*m.Brightness), u.Brightness)
+	}
+	if m.Conductivity != nil {
+		values[FieldConductivity] = m.Conductivity.In(u.Conductivity)
+	}
+	return values
+}
+
+// UnitMeasurement contains the values of a measurement in explicit units.
+type UnitMeasurement struct {
+	Temperature  *float64 `json:"temperature,omitempty"`
+	Moisture     *float64 `json:"moisture,omitempty"`
+	Brightness   *float64 `json:"brightness,omitempty"`
+	Conductivity *float64 `json:"conductivity,omitempty"`
+
+	Units map[string]string `json:"units"`
+}
+
+// In returns the measurement in the units.
+func (m *Measurement) In(u Units) *UnitMeasurement {
+	um := &UnitMeasurement{Units: make(map[string]string, 4)}
+	for field, v := range m.ValuesIn(u) {
+		v := v
+		switch field {
+		case FieldTemperature:
+			um.Temperature = &v
+		case FieldMoisture:
+			um.Moisture = &v
+		case FieldBrightness:
+			um.Brightness = &v
+		case FieldConductivity:
+			um.Conductivity = &v
+		}
+		um.Units[field] = u.Unit(field)
+	}
+	return um
+}
+
+// ParsedUnits returns the units of the measurement, missing units are
+// replaced by the default.
+func (um *UnitMeasurement) ParsedUnits() (Units, error) {
+	return ParseUnits(um.Units[FieldTemperature], um.Units[FieldConductivity], um.Units[FieldBrightness])
+}
+
+// Measurement converts the values back to a measurement.
+func (um *UnitMeasurement) Measurement() (*Measurement, error) {
+	u, err := um.ParsedUnits()
+	if err != nil {
+		return nil, err
+	}
+	return NewMeasurement(u, um.Temperature, um.Moisture, um.Brightness, um.Conductivity), nil
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, math.Round(v)))
+}
+
+// NewMeasurement returns a measurement from values in the units, nil values
+// are not set.
+func NewMeasurement(u Units, temperature, moisture, brightness, conductivity *float64) *Measurement {
+	m := &Measurement{}
+	if temperature != nil {
+		v := Temperature(clamp(u.ConvertFrom(FieldTemperature, *temperature)*10, math.MinInt16, math.MaxInt16))
+		m.Temperature = &v
+	}
+	if moisture != nil {
+		v := uint8(clamp(*moisture, 0, math.MaxUint8))
+		m.Moisture = &v
+	}
+	if brightness != nil {
+		v := uint16(clamp(u.ConvertFrom(FieldBrightness, *brightness), 0, math.MaxUint16))
+		m.Brightness = &v
+	}
+	if conductivity != nil {
+		v := Conductivity(clamp(u.ConvertFrom(FieldConductivity, *conductivity)*10000, 0, math.MaxUint16))
+		m.Conductivity = &v
+	}
+	return m
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnits(t *testing.T) {
+	temperature := Temperature(215)
+	moisture := uint8(34)
+	brightness := uint16(1076)
+	conductivity := Conductivity(123)
+	m := &Measurement{
+		Temperature:  &temperature,
+		Moisture:     &moisture,
+		Brightness:   &brightness,
+		Conductivity: &conductivity,
+	}
+
+	assert.Equal(t, map[string]float64{
+		FieldTemperature:  21.5,
+		FieldMoisture:     34,
+		FieldBrightness:   1076,
+		FieldConductivity: 0.0123,
+	}, m.ValuesIn(DefaultUnits()))
+
+	u, err := ParseUnits("fahrenheit", "microsiemens_per_centimeter", "foot_candles")
+	require.NoError(t, err)
+	values := m.ValuesIn(u)
+	assert.InDelta(t, 70.7, values[FieldTemperature], 1e-9)
+	assert.Equal(t, 34.0, values[FieldMoisture])
+	assert.InDelta(t, 99.96, values[FieldBrightness], 0.01)
+	assert.Equal(t, 123.0, values[FieldConductivity])
+
+	assert.InDelta(t, 294.65, temperature.In(Kelvin), 1e-9)
+	assert.InDelta(t, 2000.0, u.Convert(FieldConductivity, 0.2), 1e-9)
+
+	um := m.In(u)
+	assert.Equal(t, "fahrenheit", um.Units[FieldTemperature])
+	assert.Equal(t, "percent", um.Units[FieldMoisture])
+
+	_, err = ParseUnits("rankine", "", "")
+	assert.Error(t, err)
+	u, err = ParseUnits("", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultUnits(), u)
+}
@@ -0,0 +1,447 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ble/ble/linux"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/alerting"
+	mcontext "github.com/simonswine/mi-flora-exporter/miflora/context"
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	"github.com/simonswine/mi-flora-exporter/miflora/pipeline"
+)
+
+// Options configure a MiFlora.
+type Options struct {
+	Scan     ScanOptions
+	Sessions SessionOptions
+	History  HistoryOptions
+	Exporter ExporterOptions
+
+	// Units of the measurements exposed by the exporter.
+	Units model.Units
+	// Results receives the results read by Realtime and HistoricValues.
+	Results chan<- *model.Result
+
+	// Processors are applied to the results observed by the exporter.
+	// Processors implementing prometheus.Collector are registered with the
+	// exporter's registry.
+	Processors pipeline.Pipeline
+	// Alerting is run by the exporter, if set.
+	Alerting *alerting.Engine
+	// DeviceOpener opens the adapter again, to recover from errors of the
+	// adapter. Without it a failed scan is not restarted.
+	DeviceOpener func() (*linux.Device, error)
+}
+
+// ScanOptions configure the scan for sensors.
+type ScanOptions struct {
+	Timeout time.Duration
+	// Passive scans take longer, but drain the battery of sensors less.
+	Passive bool
+	// ExpectedSensors stops the scan once this number of sensors has been
+	// found, 0 scans until the timeout.
+	ExpectedSensors int64
+	// SensorNames overrides the names of sensors, keyed by their lowercase
+	// address. If set, only these sensors are used.
+	SensorNames map[string]string
+}
+
+// SessionOptions configure the connections to sensors by Realtime and
+// HistoricValues.
+type SessionOptions struct {
+	// Concurrency is the number of sensors connected to at the same time.
+	Concurrency int
+	// SensorTimeout limits a single connection to a sensor.
+	SensorTimeout time.Duration
+	// MetricsListenAddress serves the metrics of the sessions while they
+	// run, they are not served if it is empty.
+	MetricsListenAddress string
+	// Retry configures retries of failed operations on sensors.
+	Retry RetryPolicy
+	// CircuitBreaker skips sensors with too many consecutive failures.
+	CircuitBreaker CircuitBreakerOptions
+	// Clock tracks the drift of the sensor clocks, a tracker without state
+	// file is used if nil.
+	Clock *ClockTracker
+}
+
+// HistoryOptions limit the history records read by HistoricValues.
+type HistoryOptions struct {
+	// Since and Until select the time window of records, zero values are
+	// unlimited.
+	Since time.Time
+	Until time.Time
+	// MaxRecords limits the records read per sensor, 0 is unlimited.
+	MaxRecords int
+	// Batch configures the number of records read per connection.
+	Batch BatchConfig
+}
+
+// ExporterOptions configure the exporter.
+type ExporterOptions struct {
+	BindAddress string
+	// MetricsTimestamps exposes samples with the time the advertisement
+	// has been received.
+	MetricsTimestamps bool
+	// ReadyWindow is the duration within an advertisement needs to be
+	// received for the exporter to be ready.
+	ReadyWindow time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Scan: ScanOptions{
+			Timeout: 5 * time.Second,
+		},
+		Sessions: SessionOptions{
+			Concurrency:   1,
+			SensorTimeout: 30 * time.Second,
+			Retry:         DefaultRetryPolicy(),
+			CircuitBreaker: CircuitBreakerOptions{
+				Failures: DefaultCircuitBreakerFailures,
+				Cooldown: DefaultCircuitBreakerCooldown,
+			},
+		},
+		History: HistoryOptions{
+			Batch: DefaultBatchConfig(),
+		},
+		Exporter: ExporterOptions{
+			BindAddress: ":9294",
+			ReadyWindow: 5 * time.Minute,
+		},
+		Units: model.DefaultUnits(),
+	}
+}
+
+// Validate checks the options for invalid values.
+func (o Options) Validate() error {
+	var errs []string
+	if o.Scan.Timeout <= 0 {
+		errs = append(errs, "scan timeout must be positive")
+	}
+	if o.Scan.ExpectedSensors < 0 {
+		errs = append(errs, "expected sensors must not be negative")
+	}
+	for addr := range o.Scan.SensorNames {
+		if _, err := net.ParseMAC(addr); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid sensor address '%s'", addr))
+		}
+	}
+	if o.Sessions.Concurrency < 1 {
+		errs = append(errs, "concurrency must be at least 1")
+	}
+	if o.Sessions.SensorTimeout <= 0 {
+		errs = append(errs, "sensor timeout must be positive")
+	}
+	errs = append(errs, o.Sessions.Retry.validate()...)
+	errs = append(errs, o.Sessions.CircuitBreaker.validate()...)
+	if !o.History.Since.IsZero() && !o.History.Until.IsZero() && o.History.Until.Before(o.History.Since) {
+		errs = append(errs, "history until must not be before since")
+	}
+	if o.History.MaxRecords < 0 {
+		errs = append(errs, "history max records must not be negative")
+	}
+	errs = append(errs, o.History.Batch.validate()...)
+	if o.Exporter.BindAddress == "" {
+		errs = append(errs, "bind address must not be empty")
+	}
+	if o.Exporter.ReadyWindow <= 0 {
+		errs = append(errs, "ready window must be positive")
+	}
+	if u, err := model.ParseUnits(string(o.Units.Temperature), string(o.Units.Conductivity), string(o.Units.Brightness)); err != nil {
+		errs = append(errs, err.Error())
+	} else if u != o.Units {
+		errs = append(errs, "units must not be empty")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid options: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Option changes the options of a MiFlora.
+type Option func(*Options) error
+
+// WithOptions replaces all options.
+func WithOptions(v Options) Option {
+	return func(o *Options) error {
+		*o = v
+		return nil
+	}
+}
+
+func WithScanTimeout(v time.Duration) Option {
+	return func(o *Options) error {
+		o.Scan.Timeout = v
+		return nil
+	}
+}
+
+func WithScanPassive(v bool) Option {
+	return func(o *Options) error {
+		o.Scan.Passive = v
+		return nil
+	}
+}
+
+func WithExpectedSensors(v int64) Option {
+	return func(o *Options) error {
+		o.Scan.ExpectedSensors = v
+		return nil
+	}
+}
+
+// WithSensorNames overrides the names of sensors, given in the format
+// <name>=<address>.
+func WithSensorNames(v ...string) Option {
+	return func(o *Options) error {
+		names, err := parseSensorNames(v)
+		if err != nil {
+			return err
+		}
+		o.Scan.SensorNames = names
+		return nil
+	}
+}
+
+func parseSensorNames(v []string) (map[string]string, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	names := make(map[string]string, len(v))
+	for _, nameOverride := range v {
+		parts := strings.SplitN(nameOverride, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sensor name '%s', expected <name>=<address>", nameOverride)
+		}
+		names[strings.ToLower(parts[1])] = parts[0]
+	}
+	return names, nil
+}
+
+func WithConcurrency(v int) Option {
+	return func(o *Options) error {
+		o.Sessions.Concurrency = v
+		return nil
+	}
+}
+
+func WithSensorTimeout(v time.Duration) Option {
+	return func(o *Options) error {
+		o.Sessions.SensorTimeout = v
+		return nil
+	}
+}
+
+// WithMetricsListenAddress serves the metrics of Realtime and HistoricValues
+// on the address while they run.
+func WithMetricsListenAddress(v string) Option {
+	return func(o *Options) error {
+		o.Sessions.MetricsListenAddress = v
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the retry policy for operations on sensors.
+func WithRetryPolicy(v RetryPolicy) Option {
+	return func(o *Options) error {
+		o.Sessions.Retry = v
+		return nil
+	}
+}
+
+// WithCircuitBreaker skips sensors for the cooldown after the given number
+// of consecutive failed connections. A number of 0 disables the circuit
+// breaker.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(o *Options) error {
+		o.Sessions.CircuitBreaker = CircuitBreakerOptions{Failures: failures, Cooldown: cooldown}
+		return nil
+	}
+}
+
+// WithClockTracker sets the tracker of the sensor clocks, which corrects
+// the timestamps of history records.
+func WithClockTracker(v *ClockTracker) Option {
+	return func(o *Options) error {
+		if v == nil {
+			return errors.New("clock tracker must not be nil")
+		}
+		o.Sessions.Clock = v
+		return nil
+	}
+}
+
+// WithHistoryWindow selects the time window of history records, zero
+// values are unlimited.
+func WithHistoryWindow(since, until time.Time) Option {
+	return func(o *Options) error {
+		o.History.Since = since
+		o.History.Until = until
+		return nil
+	}
+}
+
+func WithHistoryMaxRecords(v int) Option {
+	return func(o *Options) error {
+		o.History.MaxRecords = v
+		return nil
+	}
+}
+
+// WithHistoryBatch sets the number of history records read per connection.
+func WithHistoryBatch(v BatchConfig) Option {
+	return func(o *Options) error {
+		o.History.Batch = v
+		return nil
+	}
+}
+
+func WithBindAddress(v string) Option {
+	return func(o *Options) error {
+		o.Exporter.BindAddress = v
+		return nil
+	}
+}
+
+func WithMetricsTimestamps(v bool) Option {
+	return func(o *Options) error {
+		o.Exporter.MetricsTimestamps = v
+		return nil
+	}
+}
+
+func WithReadyWindow(v time.Duration) Option {
+	return func(o *Options) error {
+		o.Exporter.ReadyWindow = v
+		return nil
+	}
+}
+
+func WithUnits(v model.Units) Option {
+	return func(o *Options) error {
+		o.Units = v
+		return nil
+	}
+}
+
+// WithResults sets the channel receiving the results read by Realtime and
+// HistoricValues.
+func WithResults(v chan<- *model.Result) Option {
+	return func(o *Options) error {
+		if v == nil {
+			return errors.New("results channel must not be nil")
+		}
+		o.Results = v
+		return nil
+	}
+}
+
+// WithProcessors sets the processors applied to the results observed by the
+// exporter.
+func WithProcessors(v ...pipeline.Processor) Option {
+	return func(o *Options) error {
+		for _, p := range v {
+			if p == nil {
+				return errors.New("processor must not be nil")
+			}
+		}
+		o.Processors = v
+		return nil
+	}
+}
+
+// WithAlerting sets the alerting engine, which is run by the exporter.
+func WithAlerting(v *alerting.Engine) Option {
+	return func(o *Options) error {
+		if v == nil {
+			return errors.New("alerting engine must not be nil")
+		}
+		o.Alerting = v
+		return nil
+	}
+}
+
+// WithDeviceOpener sets a function to open the adapter. This is used by the
+// exporter to recover from errors of the adapter.
+func WithDeviceOpener(v func() (*linux.Device, error)) Option {
+	return func(o *Options) error {
+		if v == nil {
+			return errors.New("device opener must not be nil")
+		}
+		o.DeviceOpener = v
+		return nil
+	}
+}
+
+// options returns the options overridden by values set in the context. The
+// merged options are validated again, as the context bypasses New.
+func (m *MiFlora) options(ctx context.Context) (Options, error) {
+	o := m.opts
+
+	if v, ok := mcontext.LookupScanTimeout(ctx); ok {
+		o.Scan.Timeout = v
+	}
+	if v, ok := mcontext.LookupScanPassive(ctx); ok {
+		o.Scan.Passive = v
+	}
+	if v, ok := mcontext.LookupExpectedSensors(ctx); ok {
+		o.Scan.ExpectedSensors = v
+	}
+	if v, ok := mcontext.LookupSensorNames(ctx); ok {
+		names, err := parseSensorNames(v)
+		if err != nil {
+			return Options{}, err
+		}
+		o.Scan.SensorNames = names
+	}
+	if v, ok := mcontext.LookupConcurrency(ctx); ok {
+		o.Sessions.Concurrency = v
+	}
+	if v, ok := mcontext.LookupSensorTimeout(ctx); ok {
+		o.Sessions.SensorTimeout = v
+	}
+	if v, ok := mcontext.LookupHistorySince(ctx); ok {
+		o.History.Since = v
+	}
+	if v, ok := mcontext.LookupHistoryUntil(ctx); ok {
+		o.History.Until = v
+	}
+	if v, ok := mcontext.LookupHistoryMaxRecords(ctx); ok {
+		o.History.MaxRecords = v
+	}
+	if v, ok := mcontext.LookupBindAddress(ctx); ok {
+		o.Exporter.BindAddress = v
+	}
+	if v, ok := mcontext.LookupMetricsTimestamps(ctx); ok {
+		o.Exporter.MetricsTimestamps = v
+	}
+	if v, ok := mcontext.LookupReadyWindow(ctx); ok {
+		o.Exporter.ReadyWindow = v
+	}
+	if v, ok := mcontext.LookupUnits(ctx); ok {
+		o.Units = v
+	}
+	if v, ok := mcontext.LookupResultChannel(ctx); ok && v != nil {
+		o.Results = v
+	}
+
+	if err := o.Validate(); err != nil {
+		return Options{}, err
+	}
+	return o, nil
+}
+
+// sensorName returns the name given to the sensor by the options and
+// whether the sensor has been declared.
+func (o ScanOptions) sensorName(addr string) (string, bool) {
+	name, ok := o.SensorNames[strings.ToLower(addr)]
+	return name, ok
+}
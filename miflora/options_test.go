@@ -0,0 +1,129 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mcontext "github.com/simonswine/mi-flora-exporter/miflora/context"
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func TestNewValidatesOptions(t *testing.T) {
+	m, err := New(nil,
+		WithScanTimeout(time.Minute),
+		WithSensorNames("my-plant=C4:7C:8D:AA:BB:CC"),
+		WithConcurrency(2),
+		WithRetryPolicy(RetryPolicy{Attempts: 5}),
+		WithCircuitBreaker(0, 0),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, act := 5, m.retry.Attempts; exp != act {
+		t.Errorf("unexpected retry attempts exp: %v, act: %v", exp, act)
+	}
+	if m.breaker.enabled() {
+		t.Error("expected circuit breaker to be disabled")
+	}
+	opts := m.Options()
+	if exp, act := time.Minute, opts.Scan.Timeout; exp != act {
+		t.Errorf("unexpected scan timeout exp: %v, act: %v", exp, act)
+	}
+	if name, ok := opts.Scan.sensorName("c4:7c:8d:aa:bb:cc"); !ok || name != "my-plant" {
+		t.Errorf("unexpected sensor name: %q, %v", name, ok)
+	}
+	if exp, act := DefaultOptions().Exporter.BindAddress, opts.Exporter.BindAddress; exp != act {
+		t.Errorf("unexpected bind address exp: %v, act: %v", exp, act)
+	}
+
+	now := time.Now()
+	for name, opt := range map[string]Option{
+		"scan timeout":     WithScanTimeout(0),
+		"sensor name":      WithSensorNames("my-plant"),
+		"sensor address":   WithSensorNames("my-plant=not-a-mac"),
+		"concurrency":      WithConcurrency(0),
+		"sensor timeout":   WithSensorTimeout(-time.Second),
+		"history window":   WithHistoryWindow(now, now.Add(-time.Hour)),
+		"max records":      WithHistoryMaxRecords(-1),
+		"expected sensors": WithExpectedSensors(-1),
+		"bind address":     WithBindAddress(""),
+		"ready window":     WithReadyWindow(0),
+		"units":            WithUnits(model.Units{}),
+		"results":          WithResults(nil),
+		"retry attempts":   WithRetryPolicy(RetryPolicy{}),
+		"retry jitter":     WithRetryPolicy(RetryPolicy{Attempts: 3, Jitter: 2}),
+		"breaker failures": WithCircuitBreaker(-1, time.Minute),
+		"breaker cooldown": WithCircuitBreaker(3, 0),
+		"batch size":       WithHistoryBatch(BatchConfig{}),
+		"batch limits":     WithHistoryBatch(BatchConfig{Size: 10, Adaptive: true, MinSize: 20, MaxSize: 10, FastRead: time.Second}),
+		"sensor batch":     WithHistoryBatch(BatchConfig{Size: 10, Sizes: map[string]int{"my-plant": 0}}),
+		"clock tracker":    WithClockTracker(nil),
+		"alerting":         WithAlerting(nil),
+		"processor":        WithProcessors(nil),
+		"device opener":    WithDeviceOpener(nil),
+	} {
+		if _, err := New(nil, opt); err == nil {
+			t.Errorf("expected error for invalid %s", name)
+		}
+	}
+}
+
+func TestOptionsContextOverride(t *testing.T) {
+	m, err := New(nil, WithConcurrency(2), WithSensorNames("my-plant=c4:7c:8d:aa:bb:cc"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts, err := m.options(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, act := 2, opts.Sessions.Concurrency; exp != act {
+		t.Errorf("unexpected concurrency exp: %v, act: %v", exp, act)
+	}
+
+	ctx := mcontext.ContextWithConcurrency(context.Background(), 4)
+	ctx = mcontext.ContextWithSensorNames(ctx, []string{"other-plant=c4:7c:8d:00:00:01"})
+	opts, err = m.options(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, act := 4, opts.Sessions.Concurrency; exp != act {
+		t.Errorf("unexpected concurrency exp: %v, act: %v", exp, act)
+	}
+	if _, ok := opts.Scan.sensorName("c4:7c:8d:aa:bb:cc"); ok {
+		t.Error("expected sensor names to be overridden by the context")
+	}
+	if name, _ := opts.Scan.sensorName("C4:7C:8D:00:00:01"); name != "other-plant" {
+		t.Errorf("unexpected sensor name %q", name)
+	}
+	if exp, act := 2, m.Options().Sessions.Concurrency; exp != act {
+		t.Errorf("options of MiFlora changed exp: %v, act: %v", exp, act)
+	}
+}
+
+func TestOptionsContextInvalid(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, ctx := range map[string]context.Context{
+		"concurrency":    mcontext.ContextWithConcurrency(context.Background(), 0),
+		"sensor timeout": mcontext.ContextWithSensorTimeout(context.Background(), -time.Second),
+		"units":          mcontext.ContextWithUnits(context.Background(), model.Units{}),
+		"sensor names":   mcontext.ContextWithSensorNames(context.Background(), []string{"no-address"}),
+	} {
+		if _, err := m.options(ctx); err == nil {
+			t.Errorf("expected error for invalid %s in the context", name)
+		}
+	}
+
+	// the commands fail before using the adapter
+	ctx := mcontext.ContextWithConcurrency(context.Background(), 0)
+	if err := m.HistoricValues(ctx); err == nil || errors.Is(err, ErrAdapterUnavailable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"strings"
+	"time"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// Filter drops results outside of a time range or of other sensors. Zero
+// values disable the respective check. It implements Processor.
+type Filter struct {
+	// Since drops results before this time.
+	Since time.Time
+	// Until drops results after this time.
+	Until time.Time
+	// Sensors keeps only results of sensors with these names or addresses.
+	Sensors []string
+}
+
+func (f *Filter) matchesSensor(r *model.Result) bool {
+	if len(f.Sensors) == 0 {
+		return true
+	}
+	for _, s := range f.Sensors {
+		if strings.EqualFold(s, r.Address) || (r.Name != "" && strings.EqualFold(s, r.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) matchesTime(r *model.Result) bool {
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	if r.Timestamp == nil {
+		return false
+	}
+	if !f.Since.IsZero() && r.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Process implements Processor.
+func (f *Filter) Process(r *model.Result) []*model.Result {
+	if !f.matchesSensor(r) || !f.matchesTime(r) {
+		return nil
+	}
+	return []*model.Result{r}
+}
+
+type dedupKey struct {
+	address   string
+	timestamp int64
+	kind      string
+}
+
+// Deduplicator drops results, which have already been seen for the same
+// sensor and timestamp. It implements Processor.
+type Deduplicator struct {
+	seen map[dedupKey]struct{}
+}
+
+func NewDeduplicator() *Deduplicator {
+	return &Deduplicator{seen: make(map[dedupKey]struct{})}
+}
+
+// kind distinguishes results of the same time, which carry different data.
+func kind(r *model.Result) string {
+	var b strings.Builder
+	for _, v := range []struct {
+		set bool
+		c   byte
+	}{
+		{r.Firmware != nil, 'f'},
+		{r.Measurement != nil, 'm'},
+		{r.Watering != nil, 'w'},
+		{r.DailyLight != nil, 'l'},
+	} {
+		if v.set {
+			b.WriteByte(v.c)
+		}
+	}
+	return b.String()
+}
+
+// Process implements Processor.
+func (d *Deduplicator) Process(r *model.Result) []*model.Result {
+	if r.Timestamp == nil {
+		return []*model.Result{r}
+	}
+	key := dedupKey{
+		address:   strings.ToLower(r.Address),
+		timestamp: r.Timestamp.UnixNano(),
+		kind:      kind(r),
+	}
+	if _, ok := d.seen[key]; ok {
+		return nil
+	}
+	d.seen[key] = struct{}{}
+	return []*model.Result{r}
+}
@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func result(name, address string, t time.Time) *model.Result {
+	return &model.Result{Name: name, Address: address, Timestamp: &t, Measurement: &model.Measurement{}}
+}
+
+func TestFilter(t *testing.T) {
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	f := &Filter{
+		Since:   start,
+		Until:   start.Add(time.Hour),
+		Sensors: []string{"fern", "C4:7C:8D:AA:BB:DD"},
+	}
+
+	assert.Len(t, f.Process(result("fern", "c4:7c:8d:aa:bb:cc", start)), 1)
+	assert.Len(t, f.Process(result("", "c4:7c:8d:aa:bb:dd", start.Add(time.Hour))), 1)
+	assert.Empty(t, f.Process(result("ivy", "c4:7c:8d:aa:bb:ee", start)))
+	assert.Empty(t, f.Process(result("fern", "c4:7c:8d:aa:bb:cc", start.Add(-time.Second))))
+	assert.Empty(t, f.Process(result("fern", "c4:7c:8d:aa:bb:cc", start.Add(time.Hour+time.Second))))
+	assert.Empty(t, f.Process(&model.Result{Name: "fern"}), "results without timestamp are dropped")
+}
+
+func TestDeduplicator(t *testing.T) {
+	start := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDeduplicator()
+
+	assert.Len(t, d.Process(result("fern", "c4:7c:8d:aa:bb:cc", start)), 1)
+	assert.Empty(t, d.Process(result("fern", "C4:7C:8D:AA:BB:CC", start)))
+	assert.Len(t, d.Process(result("fern", "c4:7c:8d:aa:bb:cc", start.Add(time.Hour))), 1)
+	assert.Len(t, d.Process(&model.Result{Address: "c4:7c:8d:aa:bb:cc", Timestamp: &start, Firmware: &model.Firmware{}}), 1)
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// Processor inspects and modifies results before they reach the outputs.
+type Processor interface {
+	// Process handles a single result and returns the results to pass on.
+	// This allows processors to drop results or to add derived ones.
+	Process(r *model.Result) []*model.Result
+}
+
+// Pipeline chains multiple processors.
+type Pipeline []Processor
+
+// Process passes the result through all processors in order.
+func (p Pipeline) Process(r *model.Result) []*model.Result {
+	results := []*model.Result{r}
+	for _, processor := range p {
+		var next []*model.Result
+		for _, r := range results {
+			next = append(next, processor.Process(r)...)
+		}
+		results = next
+	}
+	return results
+}
+
+// Run returns a channel, which processes all results sent to it and forwards
+// them to out. Once the returned channel is closed, out is closed as well.
+func (p Pipeline) Run(ctx context.Context, out chan *model.Result) chan *model.Result {
+	in := make(chan *model.Result)
+
+	go func() {
+		defer close(out)
+
+		for r := range in {
+			for _, r := range p.Process(r) {
+				select {
+				case out <- r:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+
+	return in
+}
@@ -0,0 +1,59 @@
+package plants
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// Evaluator annotates results of sensors assigned to a species with the
+// conditions of their values. It implements pipeline.Processor.
+type Evaluator struct {
+	profiles map[string]*Profile
+}
+
+// NewEvaluator assigns sensors to species. Each assignment has the format
+// '<sensor name or address>=<species>'.
+func NewEvaluator(db *Database, assignments []string) (*Evaluator, error) {
+	e := &Evaluator{profiles: make(map[string]*Profile)}
+	for _, assignment := range assignments {
+		parts := strings.SplitN(assignment, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid sensor species assignment '%s'", assignment)
+		}
+		p, ok := db.Lookup(parts[1])
+		if !ok {
+			return nil, fmt.Errorf("unknown plant species '%s'", parts[1])
+		}
+		e.profiles[key(parts[0])] = p
+	}
+	return e, nil
+}
+
+// Profile returns the profile assigned to the sensor, it is looked up by
+// address first and then by name.
+func (e *Evaluator) Profile(address, name string) (*Profile, bool) {
+	if p, ok := e.profiles[key(address)]; ok {
+		return p, true
+	}
+	if name == "" {
+		return nil, false
+	}
+	p, ok := e.profiles[key(name)]
+	return p, ok
+}
+
+// Process implements pipeline.Processor.
+func (e *Evaluator) Process(r *model.Result) []*model.Result {
+	p, ok := e.Profile(r.Address, r.Name)
+	if !ok {
+		return []*model.Result{r}
+	}
+
+	r.Species = p.Species
+	if r.Measurement != nil {
+		r.Conditions = p.Evaluate(r.Measurement)
+	}
+	return []*model.Result{r}
+}
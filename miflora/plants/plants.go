@@ -0,0 +1,172 @@
+package plants
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+//go:embed profiles.yaml
+var bundledProfiles []byte
+
+// Range is the preferred range of a single dimension. Both bounds are
+// optional.
+type Range struct {
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+}
+
+func (r *Range) scale(f float64) *Range {
+	if r == nil {
+		return nil
+	}
+	scaled := &Range{}
+	if r.Min != nil {
+		v := *r.Min * f
+		scaled.Min = &v
+	}
+	if r.Max != nil {
+		v := *r.Max * f
+		scaled.Max = &v
+	}
+	return scaled
+}
+
+// Profile contains the conditions a plant species prefers.
+type Profile struct {
+	Species     string `yaml:"species"`
+	DisplayName string `yaml:"display_name"`
+
+	Moisture     *Range `yaml:"moisture_percent"`
+	Brightness   *Range `yaml:"brightness_lux"`
+	Temperature  *Range `yaml:"temperature_celsius"`
+	Conductivity *Range `yaml:"conductivity_us_cm"`
+}
+
+// Ranges returns the ranges of the profile keyed by the measurement field
+// and in the same units as model.Measurement.Values.
+func (p *Profile) Ranges() map[string]*Range {
+	ranges := make(map[string]*Range, 4)
+	if p.Moisture != nil {
+		ranges[model.FieldMoisture] = p.Moisture
+	}
+	if p.Brightness != nil {
+		ranges[model.FieldBrightness] = p.Brightness
+	}
+	if p.Temperature != nil {
+		ranges[model.FieldTemperature] = p.Temperature
+	}
+	if p.Conductivity != nil {
+		// profiles use µS/cm, measurements S/m
+		ranges[model.FieldConductivity] = p.Conductivity.scale(1.0 / 10000)
+	}
+	return ranges
+}
+
+// Evaluate compares all values of the measurement with the preferred ranges.
+func (p *Profile) Evaluate(m *model.Measurement) []model.Condition {
+	values := m.Values()
+	ranges := p.Ranges()
+
+	dimensions := make([]string, 0, len(values))
+	for dimension := range values {
+		if _, ok := ranges[dimension]; ok {
+			dimensions = append(dimensions, dimension)
+		}
+	}
+	sort.Strings(dimensions)
+
+	conditions := make([]model.Condition, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		r := ranges[dimension]
+		v := values[dimension]
+		state := model.ConditionOK
+		if r.Min != nil && v < *r.Min {
+			state = model.ConditionTooLow
+		} else if r.Max != nil && v > *r.Max {
+			state = model.ConditionTooHigh
+		}
+		conditions = append(conditions, model.Condition{
+			Dimension: dimension,
+			State:     state,
+			Value:     v,
+			Min:       r.Min,
+			Max:       r.Max,
+		})
+	}
+	return conditions
+}
+
+// Database contains the profiles of plant species.
+type Database struct {
+	profiles map[string]*Profile
+}
+
+func key(species string) string {
+	return strings.ToLower(strings.TrimSpace(species))
+}
+
+// New returns a database containing the bundled profiles.
+func New() *Database {
+	db := &Database{profiles: make(map[string]*Profile)}
+	if err := db.Load(bytes.NewReader(bundledProfiles)); err != nil {
+		panic(fmt.Sprintf("failed to load bundled plant profiles: %v", err))
+	}
+	return db
+}
+
+// Load reads profiles in YAML format. Profiles for species already known
+// are replaced.
+func (db *Database) Load(r io.Reader) error {
+	var profiles []*Profile
+	if err := yaml.NewDecoder(r).Decode(&profiles); err != nil && err != io.EOF {
+		return fmt.Errorf("error decoding plant profiles: %w", err)
+	}
+
+	for pos, p := range profiles {
+		if key(p.Species) == "" {
+			return fmt.Errorf("plant profile %d has no species", pos)
+		}
+		for dimension, r := range p.Ranges() {
+			if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+				return fmt.Errorf("plant profile '%s' has min > max for %s", p.Species, dimension)
+			}
+		}
+		db.profiles[key(p.Species)] = p
+	}
+	return nil
+}
+
+// LoadFile reads profiles from a YAML file.
+func (db *Database) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return db.Load(f)
+}
+
+// Lookup returns the profile of the species.
+func (db *Database) Lookup(species string) (*Profile, bool) {
+	p, ok := db.profiles[key(species)]
+	return p, ok
+}
+
+// Species returns the names of all known species.
+func (db *Database) Species() []string {
+	species := make([]string, 0, len(db.profiles))
+	for _, p := range db.profiles {
+		species = append(species, p.Species)
+	}
+	sort.Strings(species)
+	return species
+}
@@ -0,0 +1,91 @@
+package plants
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func TestBundledProfiles(t *testing.T) {
+	db := New()
+	assert.Contains(t, db.Species(), "ficus lyrata")
+
+	p, ok := db.Lookup("Ficus Lyrata")
+	require.True(t, ok)
+	assert.Equal(t, "Fiddle-leaf fig", p.DisplayName)
+}
+
+func TestLoad(t *testing.T) {
+	db := New()
+	require.NoError(t, db.Load(strings.NewReader(`
+- species: ficus lyrata
+  moisture_percent: {min: 20}
+- species: cactus
+  moisture_percent: {max: 30}
+`)))
+
+	p, ok := db.Lookup("ficus lyrata")
+	require.True(t, ok)
+	assert.Nil(t, p.Brightness)
+	assert.Equal(t, 20.0, *p.Moisture.Min)
+
+	_, ok = db.Lookup("cactus")
+	assert.True(t, ok)
+
+	assert.Error(t, db.Load(strings.NewReader(`- moisture_percent: {min: 20}`)))
+	assert.Error(t, db.Load(strings.NewReader(`- {species: x, moisture_percent: {min: 20, max: 10}}`)))
+}
+
+func TestEvaluator(t *testing.T) {
+	db := New()
+
+	_, err := NewEvaluator(db, []string{"fern=unknown plant"})
+	assert.Error(t, err)
+	_, err = NewEvaluator(db, []string{"fern"})
+	assert.Error(t, err)
+
+	e, err := NewEvaluator(db, []string{
+		"fern=nephrolepis exaltata",
+		"C4:7C:8D:AA:BB:CC=ficus lyrata",
+	})
+	require.NoError(t, err)
+
+	moisture := uint8(14)
+	temperature := model.Temperature(215)
+	conductivity := model.Conductivity(2500)
+
+	results := e.Process(&model.Result{
+		Name:    "fern",
+		Address: "c4:7c:8d:00:00:01",
+		Measurement: &model.Measurement{
+			Moisture:     &moisture,
+			Temperature:  &temperature,
+			Conductivity: &conductivity,
+		},
+	})
+	require.Len(t, results, 1)
+	r := results[0]
+	assert.Equal(t, "nephrolepis exaltata", r.Species)
+	require.Len(t, r.Conditions, 3)
+	assert.Equal(t, model.FieldConductivity, r.Conditions[0].Dimension)
+	assert.Equal(t, model.ConditionTooHigh, r.Conditions[0].State)
+	assert.InDelta(t, 0.2, *r.Conditions[0].Max, 1e-9)
+	assert.Equal(t, model.FieldMoisture, r.Conditions[1].Dimension)
+	assert.Equal(t, model.ConditionTooLow, r.Conditions[1].State)
+	assert.Equal(t, 25.0, *r.Conditions[1].Min)
+	assert.Equal(t, model.FieldTemperature, r.Conditions[2].Dimension)
+	assert.Equal(t, model.ConditionOK, r.Conditions[2].State)
+
+	// lookup by address
+	r = e.Process(&model.Result{Address: "c4:7c:8d:aa:bb:cc"})[0]
+	assert.Equal(t, "ficus lyrata", r.Species)
+	assert.Empty(t, r.Conditions)
+
+	// unassigned sensor
+	r = e.Process(&model.Result{Address: "c4:7c:8d:00:00:02"})[0]
+	assert.Empty(t, r.Species)
+}
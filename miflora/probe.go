@@ -0,0 +1,175 @@
+package miflora
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	"github.com/simonswine/mi-flora-exporter/miflora/state"
+	mprom "github.com/simonswine/mi-flora-exporter/outputs/prometheus"
+)
+
+const (
+	probePath = "/probe"
+
+	// probeTimeout is used when Prometheus doesn't tell us its scrape timeout
+	probeTimeout = 30 * time.Second
+
+	// probeTimeoutOffset leaves some time to return the results before
+	// Prometheus gives up on the scrape
+	probeTimeoutOffset = 500 * time.Millisecond
+)
+
+func probeTimeoutFromRequest(r *http.Request) (time.Duration, error) {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return probeTimeout, nil
+	}
+
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err)
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > probeTimeoutOffset {
+		timeout -= probeTimeoutOffset
+	}
+	return timeout, nil
+}
+
+// probe connects to the sensor and reads firmware and the realtime
+// measurement from it. Like sessions, probes are retried and skipped while
+// the circuit breaker of the sensor is open.
+func (m *MiFlora) probe(ctx context.Context, logger log.Logger, addr ble.Addr) (_ *model.Result, err error) {
+	if !m.breaker.allow(addr.String()) {
+		return nil, fmt.Errorf("skipping sensor with too many consecutive failures")
+	}
+	defer func() {
+		if err == nil {
+			m.breaker.success(addr.String())
+			return
+		}
+		if _, opened := m.breaker.failure(addr.String()); opened {
+			_ = level.Warn(logger).Log("msg", "probe failed, skipping sensor", "cooldown", m.breaker.cooldown)
+		}
+	}()
+
+	c, err := m.connect(ctx, logger, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := c.Close(); err != nil {
+			_ = level.Warn(logger).Log("msg", "error canceling connection", "error", err)
+		}
+	}()
+
+	var f *model.Firmware
+	if err := c.do(ctx, opFirmware, func() (err error) {
+		f, err = c.Firmware()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("error querying firmware: %w", err)
+	}
+
+	var measurement *model.Measurement
+	if err := c.do(ctx, opMeasurement, func() (err error) {
+		measurement, err = c.Measurement()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("error querying measurement: %w", err)
+	}
+
+	// the clock metrics are exposed by the exporter
+	if o, err := c.DeviceTime(); err != nil {
+		_ = level.Debug(logger).Log("msg", "error reading device time", "error", err)
+	} else {
+		m.observeClock(logger, addr.String(), o)
+	}
+
+	now := time.Now()
+	return &model.Result{
+		Address:     addr.String(),
+		Timestamp:   &now,
+		Firmware:    f,
+		Measurement: measurement,
+	}, nil
+}
+
+// probeHandler reads a single sensor on request, similar to the
+// blackbox_exporter. The sensor is selected using the target parameter.
+// Successful probes are also recorded in the store, if one is given.
+func (m *MiFlora) probeHandler(opts Options, store *state.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		if _, err := net.ParseMAC(target); err != nil {
+			http.Error(w, fmt.Sprintf("Target parameter is not a valid address: %s", err), http.StatusBadRequest)
+			return
+		}
+		addr := ble.NewAddr(target)
+
+		timeout, err := probeTimeoutFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		probeCtx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		name, _ := opts.Scan.sensorName(addr.String())
+
+		logger := log.With(m.logger, "address", addr.String(), "probe", true)
+		if len(name) > 0 {
+			logger = log.With(logger, "name", name)
+		}
+
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_success",
+			Help: "Displays whether or not the probe was a success",
+		})
+		probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_duration_seconds",
+			Help: "Returns how long the probe took to complete in seconds",
+		})
+		collector := mprom.NewCollector().WithUnits(opts.Units)
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(probeSuccess, probeDuration, collector)
+
+		start := time.Now()
+		result, err := m.probe(probeCtx, logger, addr)
+		probeDuration.Set(time.Since(start).Seconds())
+
+		if err != nil {
+			_ = level.Warn(logger).Log("msg", "probe failed", "duration", time.Since(start), "error", err)
+		} else {
+			result.Name = name
+			for _, result := range m.processors.Process(result) {
+				collector.ObserveResult(result)
+				if store != nil {
+					store.ObserveResult(result)
+				}
+			}
+			probeSuccess.Set(1)
+			_ = result.Measurement.LogWith(level.Debug(logger)).Log("msg", "probe succeeded", "duration", time.Since(start))
+		}
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,111 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/go-ble/ble/linux"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/light"
+)
+
+func TestProbeTimeoutFromRequest(t *testing.T) {
+	for _, tc := range []struct {
+		header   string
+		expected time.Duration
+		err      bool
+	}{
+		{header: "", expected: probeTimeout},
+		{header: "10", expected: 9500 * time.Millisecond},
+		{header: "0.2", expected: 200 * time.Millisecond},
+		{header: "ten", err: true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/probe?target=c4:7c:8d:aa:bb:cc", nil)
+		if tc.header != "" {
+			r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tc.header)
+		}
+		timeout, err := probeTimeoutFromRequest(r)
+		if tc.err {
+			if err == nil {
+				t.Errorf("expected error for header %q", tc.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for header %q: %v", tc.header, err)
+		}
+		if exp, act := tc.expected, timeout; exp != act {
+			t.Errorf("unexpected timeout exp: %v, act: %v", exp, act)
+		}
+	}
+}
+
+func TestProbeHandlerInvalidTarget(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"", "not-a-mac"} {
+		w := httptest.NewRecorder()
+		m.probeHandler(m.Options(), nil)(w, httptest.NewRequest(http.MethodGet, "/probe?target="+target, nil))
+		if exp, act := http.StatusBadRequest, w.Code; exp != act {
+			t.Errorf("unexpected status code for target %q exp: %v, act: %v", target, exp, act)
+		}
+	}
+}
+
+func TestAdapterUnavailableAfterFailedReopen(t *testing.T) {
+	m, err := New(nil, WithDeviceOpener(func() (*linux.Device, error) {
+		return nil, errors.New("no adapter")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := m.reopenDevice(ctx); err == nil {
+		t.Fatal("expected error reopening the adapter")
+	}
+
+	addr := ble.NewAddr("c4:7c:8d:aa:bb:cc")
+	if _, err := m.probe(ctx, m.logger, addr); !errors.Is(err, ErrAdapterUnavailable) {
+		t.Errorf("unexpected probe error: %v", err)
+	}
+	if _, err := m.connect(ctx, m.logger, addr); !errors.Is(err, ErrAdapterUnavailable) {
+		t.Errorf("unexpected connect error: %v", err)
+	}
+	if err := m.doScanReal(ctx, nil); !errors.Is(err, ErrAdapterUnavailable) {
+		t.Errorf("unexpected scan error: %v", err)
+	}
+}
+
+func TestExporterRestart(t *testing.T) {
+	m, err := New(nil, WithBindAddress("127.0.0.1:0"), WithProcessors(light.New(light.Config{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the exporter stops without an adapter, running it again must not
+	// register the metrics twice
+	for i := 0; i < 2; i++ {
+		if err := m.Exporter(context.Background()); !errors.Is(err, ErrAdapterUnavailable) {
+			t.Errorf("unexpected error of run %d: %v", i, err)
+		}
+	}
+}
+
+func TestProbeCircuitBreaker(t *testing.T) {
+	m := &MiFlora{breaker: newCircuitBreaker(1, time.Hour)}
+	addr := ble.NewAddr("c4:7c:8d:aa:bb:cc")
+	m.breaker.failure(addr.String())
+
+	// the sensor is skipped without connecting to it
+	if _, err := m.probe(context.Background(), nil, addr); err == nil {
+		t.Error("expected error for sensor with open circuit")
+	}
+}
@@ -0,0 +1,244 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/go-ble/ble/linux/hci"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// RetryPolicy configures how often failed operations on a sensor are
+// retried.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts of an operation, values
+	// below 2 disable retries.
+	Attempts int
+	// Backoff is the wait time before the first retry, it doubles with
+	// every further retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter randomizes the backoff by the given fraction.
+	Jitter float64
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:   3,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+		Jitter:     0.2,
+	}
+}
+
+func (p RetryPolicy) validate() []string {
+	var errs []string
+	if p.Attempts < 1 {
+		errs = append(errs, "retry attempts must be at least 1")
+	}
+	if p.Backoff < 0 || p.MaxBackoff < 0 {
+		errs = append(errs, "retry backoff must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		errs = append(errs, "retry jitter must be between 0 and 1")
+	}
+	return errs
+}
+
+// backoff returns the wait time after the given number of failed attempts.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// do runs f until it succeeds, fails with a permanent error or the attempts
+// are used up.
+func (p RetryPolicy) do(ctx context.Context, logger log.Logger, metrics *metrics, operation string, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= p.Attempts || !isTransient(err) {
+			return err
+		}
+
+		backoff := p.backoff(attempt)
+		_ = level.Debug(logger).Log("msg", "retrying operation", "operation", operation, "attempt", attempt, "backoff", backoff, "error", err)
+		metrics.observeRetry(operation)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// disconnectedError is returned by operations failed after the connection
+// to the sensor is closed, they are not resolved by retrying.
+type disconnectedError struct {
+	err error
+}
+
+func (e *disconnectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *disconnectedError) Unwrap() error {
+	return e.err
+}
+
+func (e *disconnectedError) Is(target error) bool {
+	return target == ErrDisconnected
+}
+
+// isTransient classifies errors into transient ones, which might succeed
+// on a retry, and permanent ones.
+func isTransient(err error) bool {
+	var disconnectedErr *disconnectedError
+	if errors.As(err, &disconnectedErr) {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrCharacteristicNotFound) ||
+		errors.Is(err, ErrAdapterUnavailable) ||
+		errors.Is(err, hci.ErrInvalidAddr) {
+		return false
+	}
+
+	var attErr ble.ATTError
+	if errors.As(err, &attErr) {
+		switch attErr {
+		case ble.ErrInvalidHandle,
+			ble.ErrReadNotPerm,
+			ble.ErrWriteNotPerm,
+			ble.ErrAuthentication,
+			ble.ErrReqNotSupp,
+			ble.ErrAuthorization,
+			ble.ErrAttrNotFound:
+			return false
+		}
+	}
+
+	return true
+}
+
+const (
+	DefaultCircuitBreakerFailures = 5
+	DefaultCircuitBreakerCooldown = 15 * time.Minute
+)
+
+// CircuitBreakerOptions configure skipping sensors after consecutive failed
+// connections.
+type CircuitBreakerOptions struct {
+	// Failures is the number of consecutive failures, after which a sensor
+	// is skipped. 0 disables the circuit breaker.
+	Failures int
+	// Cooldown is the duration for which a sensor is skipped.
+	Cooldown time.Duration
+}
+
+func (o CircuitBreakerOptions) validate() []string {
+	var errs []string
+	if o.Failures < 0 {
+		errs = append(errs, "circuit breaker failures must not be negative")
+	}
+	if o.Failures > 0 && o.Cooldown <= 0 {
+		errs = append(errs, "circuit breaker cooldown must be positive")
+	}
+	return errs
+}
+
+// circuitBreaker counts the consecutive failures of sensors and skips
+// sensors with too many failures for a while.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	sensors   map[string]*breakerState
+	now       func() time.Time
+}
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		sensors:   make(map[string]*breakerState),
+		now:       time.Now,
+	}
+}
+
+func (b *circuitBreaker) state(addr string) *breakerState {
+	addr = strings.ToLower(addr)
+	s, ok := b.sensors[addr]
+	if !ok {
+		s = &breakerState{}
+		b.sensors[addr] = s
+	}
+	return s
+}
+
+// enabled returns false if the circuit breaker never opens.
+func (b *circuitBreaker) enabled() bool {
+	return b != nil && b.threshold > 0
+}
+
+// allow returns false while the circuit of the sensor is open.
+func (b *circuitBreaker) allow(addr string) bool {
+	if !b.enabled() {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.now().Before(b.state(addr).openUntil)
+}
+
+// success resets the consecutive failures of the sensor.
+func (b *circuitBreaker) success(addr string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state(addr)
+	s.failures = 0
+	s.openUntil = time.Time{}
+}
+
+// failure records a failure of the sensor and returns the number of
+// consecutive failures. It opens the circuit once the threshold is
+// reached.
+func (b *circuitBreaker) failure(addr string) (failures int, opened bool) {
+	if b == nil {
+		return 0, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state(addr)
+	s.failures++
+	if b.threshold > 0 && s.failures >= b.threshold {
+		s.openUntil = b.now().Add(b.cooldown)
+		return s.failures, true
+	}
+	return s.failures, false
+}
@@ -0,0 +1,91 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/go-kit/kit/log"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, exp := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  5 * time.Second,
+		10: 5 * time.Second,
+	} {
+		if act := p.backoff(attempt); exp != act {
+			t.Errorf("unexpected backoff for attempt %d, exp: %s, act: %s", attempt, exp, act)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if act := p.backoff(2); act < time.Second || act > 3*time.Second {
+			t.Errorf("backoff with jitter out of range: %s", act)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	for _, tc := range []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{name: "success", attempts: 1},
+		{name: "transient", err: errors.New("req timeout"), attempts: 3},
+		{name: "disconnected", err: &disconnectedError{err: errors.New("disconnected")}, attempts: 1},
+		{name: "missing-characteristic", err: fmt.Errorf("read: %w", ErrCharacteristicNotFound), attempts: 1},
+		{name: "att-not-permitted", err: ble.ErrReadNotPerm, attempts: 1},
+		{name: "deadline", err: context.DeadlineExceeded, attempts: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int
+			err := p.do(context.Background(), log.NewNopLogger(), nil, opFirmware, func() error {
+				attempts++
+				return tc.err
+			})
+			if !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.attempts != attempts {
+				t.Errorf("unexpected attempts, exp: %d, act: %d", tc.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	if _, opened := b.failure("AA"); opened {
+		t.Error("circuit opened after first failure")
+	}
+	if failures, opened := b.failure("aa"); !opened || failures != 2 {
+		t.Errorf("circuit not opened, failures: %d", failures)
+	}
+	if b.allow("aa") {
+		t.Error("sensor allowed while circuit is open")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow("aa") {
+		t.Error("sensor not allowed after cooldown")
+	}
+
+	b.success("aa")
+	if _, opened := b.failure("aa"); opened {
+		t.Error("failures not reset after success")
+	}
+}
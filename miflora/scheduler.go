@@ -0,0 +1,138 @@
+package miflora
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// session is a connection to a single sensor. It returns the results read
+// from the sensor, which are handed to the outputs once the session ended.
+// Results read before an error are still handed to the outputs.
+type session func(ctx context.Context, s *Sensor) ([]*model.Result, error)
+
+// sortByRSSI orders the sensors by their signal strength, the strongest
+// first.
+func sortByRSSI(sensors []*Sensor) []*Sensor {
+	sorted := make([]*Sensor, len(sensors))
+	copy(sorted, sensors)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].advertisement.RSSI() > sorted[j].advertisement.RSSI()
+	})
+	return sorted
+}
+
+// runSessions runs a session for every sensor, with up to the concurrency
+// from the options running at the same time. Every session is limited by
+// the sensor timeout from the options. The results of a sensor are sent to
+// the result channel together and in order, sensors are started in order of
+// their signal strength. Sensors skipped by the circuit breaker are not
+// connected to.
+func (m *MiFlora) runSessions(ctx context.Context, sensors []*Sensor, f session) error {
+	opts, err := m.options(ctx)
+	if err != nil {
+		return err
+	}
+	resultCh := opts.Results
+	timeout := opts.Sessions.SensorTimeout
+
+	concurrency := opts.Sessions.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type sessionResults struct {
+		sensor  *Sensor
+		results []*model.Result
+	}
+	doneCh := make(chan sessionResults)
+
+	var wg sync.WaitGroup
+	go func() {
+		sem := make(chan struct{}, concurrency)
+		defer func() {
+			wg.Wait()
+			close(doneCh)
+		}()
+
+		for _, s := range sortByRSSI(sensors) {
+			if !m.breaker.allow(s.advertisement.Addr().String()) {
+				_ = level.Debug(s.logger).Log("msg", "skipping sensor after consecutive failures")
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case sem <- struct{}{}:
+			}
+
+			wg.Add(1)
+			go func(s *Sensor) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				sessionCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+
+				results, err := f(sessionCtx, s)
+				if ctx.Err() == nil {
+					m.observeSession(s, err)
+				}
+				select {
+				case <-ctx.Done():
+				case doneCh <- sessionResults{sensor: s, results: results}:
+				}
+			}(s)
+		}
+	}()
+
+	for done := range doneCh {
+		if resultCh == nil {
+			continue
+		}
+		for _, r := range done.results {
+			select {
+			case <-ctx.Done():
+				// drain the remaining sessions
+				for range doneCh {
+				}
+				return ctx.Err()
+			case resultCh <- r:
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// observeSession logs a failed session and updates the consecutive failures
+// of the sensor.
+func (m *MiFlora) observeSession(s *Sensor, err error) {
+	addr := s.advertisement.Addr().String()
+	if err == nil {
+		s.failures = 0
+		m.breaker.success(addr)
+		if m.metrics != nil {
+			m.metrics.consecutiveFailures.WithLabelValues(addr).Set(0)
+		}
+		return
+	}
+
+	s.failures++
+	failures, opened := m.breaker.failure(addr)
+	if m.metrics != nil {
+		m.metrics.consecutiveFailures.WithLabelValues(addr).Set(float64(failures))
+	}
+	logger := log.With(level.Warn(s.logger), "error", err, "consecutive_failures", failures)
+	if opened {
+		_ = logger.Log("msg", "session failed, skipping sensor", "cooldown", m.breaker.cooldown)
+		return
+	}
+	_ = logger.Log("msg", "session failed")
+}
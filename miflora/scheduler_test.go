@@ -0,0 +1,197 @@
+package miflora
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func newFakeSensor(addr string, rssi int) *Sensor {
+	a := newFakeAdvertisement(addr)
+	a.rssi = rssi
+	return &Sensor{advertisement: a, name: addr, logger: log.NewNopLogger()}
+}
+
+func TestSortByRSSI(t *testing.T) {
+	sensors := []*Sensor{
+		newFakeSensor("a", -90),
+		newFakeSensor("b", -40),
+		newFakeSensor("c", -70),
+	}
+
+	var act []string
+	for _, s := range sortByRSSI(sensors) {
+		act = append(act, s.name)
+	}
+	if exp := []string{"b", "c", "a"}; len(act) != 3 || act[0] != exp[0] || act[1] != exp[1] || act[2] != exp[2] {
+		t.Errorf("unexpected order, exp: %v, act: %v", exp, act)
+	}
+	if sensors[0].name != "a" {
+		t.Error("input slice has been modified")
+	}
+}
+
+func TestRunSessions(t *testing.T) {
+	var sensors []*Sensor
+	for i, addr := range []string{"a", "b", "c", "d", "e", "f"} {
+		sensors = append(sensors, newFakeSensor(addr, -i))
+	}
+
+	resultCh := make(chan *model.Result)
+	opts := DefaultOptions()
+	opts.Results = resultCh
+	opts.Sessions.Concurrency = 3
+	opts.Sessions.SensorTimeout = time.Second
+	ctx := context.Background()
+
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+	session := func(ctx context.Context, s *Sensor) ([]*model.Result, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("session of %s has no deadline", s.name)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		var results []*model.Result
+		for i := 0; i < 3; i++ {
+			ts := time.Unix(int64(i), 0)
+			results = append(results, &model.Result{Address: s.name, Timestamp: &ts})
+		}
+		return results, nil
+	}
+
+	m := &MiFlora{opts: opts}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.runSessions(ctx, sensors, session)
+		close(resultCh)
+	}()
+
+	var results []*model.Result
+	for r := range resultCh {
+		results = append(results, r)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if exp, act := 18, len(results); exp != act {
+		t.Fatalf("unexpected number of results, exp: %d, act: %d", exp, act)
+	}
+	// results of a sensor are handed over together and in order
+	seen := make(map[string]bool)
+	for i := 0; i < len(results); i += 3 {
+		addr := results[i].Address
+		if seen[addr] {
+			t.Errorf("results of sensor %s are not grouped", addr)
+		}
+		seen[addr] = true
+		for j := 0; j < 3; j++ {
+			if r := results[i+j]; r.Address != addr || r.Timestamp.Unix() != int64(j) {
+				t.Errorf("unexpected result at %d: %s %d", i+j, r.Address, r.Timestamp.Unix())
+			}
+		}
+	}
+	if peak != 3 {
+		t.Errorf("unexpected peak of concurrent sessions, exp: 3, act: %d", peak)
+	}
+}
+
+func TestRunSessionsCircuitBreaker(t *testing.T) {
+	sensors := []*Sensor{
+		newFakeSensor("good", -50),
+		newFakeSensor("bad", -60),
+	}
+
+	m := &MiFlora{breaker: newCircuitBreaker(2, time.Hour), opts: DefaultOptions()}
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	session := func(ctx context.Context, s *Sensor) ([]*model.Result, error) {
+		mu.Lock()
+		calls[s.name]++
+		mu.Unlock()
+		if s.name == "bad" {
+			return nil, errors.New("failed to dial")
+		}
+		return nil, nil
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := m.runSessions(ctx, sensors, session); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if exp, act := 4, calls["good"]; exp != act {
+		t.Errorf("unexpected sessions of good sensor, exp: %d, act: %d", exp, act)
+	}
+	if exp, act := 2, calls["bad"]; exp != act {
+		t.Errorf("unexpected sessions of bad sensor, exp: %d, act: %d", exp, act)
+	}
+}
+
+func TestPendingSensorsWithoutCircuitBreaker(t *testing.T) {
+	good := newFakeSensor("good", -50)
+	sensors := []*Sensor{
+		good,
+		newFakeSensor("bad", -60),
+	}
+
+	m := &MiFlora{
+		breaker: newCircuitBreaker(0, time.Hour),
+		retry:   RetryPolicy{Attempts: 3},
+		opts:    DefaultOptions(),
+	}
+	ctx := context.Background()
+
+	calls := make(map[string]int)
+	session := func(ctx context.Context, s *Sensor) ([]*model.Result, error) {
+		calls[s.name]++
+		if s.name == "bad" {
+			return nil, errors.New("failed to dial")
+		}
+		if calls[s.name] == 2 {
+			s.historyDone = true
+		}
+		return nil, nil
+	}
+
+	for i := 0; len(sensors) > 0; i++ {
+		if i > 10 {
+			t.Fatal("sensors still pending after 10 rounds")
+		}
+		if err := m.runSessions(ctx, sensors, session); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sensors = m.pendingSensors(sensors)
+	}
+
+	if exp, act := 2, calls["good"]; exp != act {
+		t.Errorf("unexpected sessions of good sensor, exp: %d, act: %d", exp, act)
+	}
+	if exp, act := 3, calls["bad"]; exp != act {
+		t.Errorf("unexpected sessions of bad sensor, exp: %d, act: %d", exp, act)
+	}
+}
@@ -0,0 +1,291 @@
+package state
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// Value is the last known value of a single measurement field.
+type Value struct {
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Firmware struct {
+	model.Firmware
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ring keeps the most recent values of a measurement field.
+type ring struct {
+	values []Value
+	next   int
+	full   bool
+}
+
+func newRing(size int) *ring {
+	return &ring{values: make([]Value, size)}
+}
+
+func (r *ring) add(v Value) {
+	if len(r.values) == 0 {
+		return
+	}
+	r.values[r.next] = v
+	r.next = (r.next + 1) % len(r.values)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the values ordered from oldest to newest.
+func (r *ring) list() []Value {
+	if !r.full {
+		return append([]Value{}, r.values[:r.next]...)
+	}
+	return append(append([]Value{}, r.values[r.next:]...), r.values[:r.next]...)
+}
+
+// Sensor contains everything known about a sensor.
+type Sensor struct {
+	Name         string               `json:"name"`
+	Address      string               `json:"address"`
+	Labels       map[string]string    `json:"labels"`
+	RSSI         *int                 `json:"rssi,omitempty"`
+	LastSeen     *time.Time           `json:"last_seen,omitempty"`
+	FrameCounter *uint8               `json:"frame_counter,omitempty"`
+	Firmware     *Firmware            `json:"firmware,omitempty"`
+	Measurements map[string]Value     `json:"measurements"`
+	Units        map[string]string    `json:"units"`
+	Species      string               `json:"species,omitempty"`
+	Conditions   []model.Condition    `json:"conditions,omitempty"`
+	LastWatering *model.WateringEvent `json:"last_watering,omitempty"`
+	DailyLight   *model.DailyLight    `json:"daily_light,omitempty"`
+
+	MoistureForecast *model.MoistureForecast `json:"moisture_forecast,omitempty"`
+
+	// History contains the recent values of each measurement field, it is
+	// only populated when requested.
+	History map[string][]Value `json:"history,omitempty"`
+
+	history map[string]*ring
+}
+
+func (s *Sensor) copy(withHistory bool) Sensor {
+	c := *s
+	c.Labels = make(map[string]string, len(s.Labels))
+	for k, v := range s.Labels {
+		c.Labels[k] = v
+	}
+	c.Conditions = append([]model.Condition{}, s.Conditions...)
+	c.Units = make(map[string]string, len(s.Units))
+	for k, v := range s.Units {
+		c.Units[k] = v
+	}
+	c.Measurements = make(map[string]Value, len(s.Measurements))
+	for k, v := range s.Measurements {
+		c.Measurements[k] = v
+	}
+	if s.Firmware != nil {
+		f := *s.Firmware
+		c.Firmware = &f
+	}
+	if s.LastWatering != nil {
+		w := *s.LastWatering
+		c.LastWatering = &w
+	}
+	if s.DailyLight != nil {
+		l := *s.DailyLight
+		c.DailyLight = &l
+	}
+	if s.MoistureForecast != nil {
+		f := *s.MoistureForecast
+		c.MoistureForecast = &f
+	}
+	c.history = nil
+	if withHistory {
+		c.History = make(map[string][]Value, len(s.history))
+		for k, r := range s.history {
+			c.History[k] = r.list()
+		}
+	}
+	return c
+}
+
+// setCondition replaces the condition of the same dimension.
+func (s *Sensor) setCondition(c model.Condition) {
+	for pos := range s.Conditions {
+		if s.Conditions[pos].Dimension == c.Dimension {
+			s.Conditions[pos] = c
+			return
+		}
+	}
+	s.Conditions = append(s.Conditions, c)
+	sort.Slice(s.Conditions, func(i, j int) bool {
+		return s.Conditions[i].Dimension < s.Conditions[j].Dimension
+	})
+}
+
+// Store keeps the latest state of all sensors seen. It is safe for
+// concurrent use.
+type Store struct {
+	mu          sync.RWMutex
+	sensors     map[string]*Sensor
+	labels      func(address, name string) map[string]string
+	historySize int
+	units       model.Units
+}
+
+// DefaultHistorySize is the number of recent values kept per measurement
+// field.
+const DefaultHistorySize = 120
+
+func New() *Store {
+	return &Store{
+		sensors: make(map[string]*Sensor),
+		labels: func(address, name string) map[string]string {
+			return map[string]string{}
+		},
+		historySize: DefaultHistorySize,
+		units:       model.DefaultUnits(),
+	}
+}
+
+// WithUnits selects the units measurements and conditions are kept in.
+func (s *Store) WithUnits(u model.Units) *Store {
+	s.units = u
+	return s
+}
+
+// WithHistorySize sets the number of recent values kept per measurement
+// field.
+func (s *Store) WithHistorySize(n int) *Store {
+	s.historySize = n
+	return s
+}
+
+// WithLabels sets the function used to derive the labels of a sensor.
+func (s *Store) WithLabels(f func(address, name string) map[string]string) *Store {
+	s.labels = f
+	return s
+}
+
+func key(address string) string {
+	return strings.ToLower(address)
+}
+
+func (s *Store) sensor(address, name string) *Sensor {
+	e, ok := s.sensors[key(address)]
+	if !ok {
+		e = &Sensor{
+			Address:      address,
+			Measurements: make(map[string]Value),
+			Units:        s.units.Map(),
+			history:      make(map[string]*ring),
+		}
+		s.sensors[key(address)] = e
+	}
+	if !ok || e.Name != name {
+		e.Name = name
+		e.Labels = s.labels(address, name)
+	}
+	return e
+}
+
+// ObserveAdvertisement records the reception of an advertisement.
+func (s *Store) ObserveAdvertisement(address, name string, t time.Time, rssi int, frameCounter uint8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.sensor(address, name)
+	e.RSSI = &rssi
+	e.LastSeen = &t
+	e.FrameCounter = &frameCounter
+}
+
+// ObserveResult records firmware and measurement values of a result. If the
+// result carries no timestamp the current time is used.
+func (s *Store) ObserveResult(r *model.Result) {
+	t := time.Now()
+	if r.Timestamp != nil {
+		t = *r.Timestamp
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.sensor(r.Address, r.Name)
+	if r.Firmware != nil {
+		e.Firmware = &Firmware{
+			Firmware:  *r.Firmware,
+			Timestamp: t,
+		}
+	}
+	if r.Measurement != nil {
+		for field, v := range r.Measurement.ValuesIn(s.units) {
+			value := Value{Value: v, Timestamp: t}
+			e.Measurements[field] = value
+
+			h, ok := e.history[field]
+			if !ok {
+				h = newRing(s.historySize)
+				e.history[field] = h
+			}
+			h.add(value)
+		}
+	}
+	if r.Species != "" {
+		e.Species = r.Species
+	}
+	for _, c := range r.Conditions {
+		e.setCondition(s.units.ConvertCondition(c))
+	}
+	if w := r.Watering; w != nil && (e.LastWatering == nil || w.Timestamp.After(e.LastWatering.Timestamp)) {
+		watering := *w
+		e.LastWatering = &watering
+	}
+	if l := r.DailyLight; l != nil && (e.DailyLight == nil || l.Date > e.DailyLight.Date) {
+		dailyLight := *l
+		e.DailyLight = &dailyLight
+	}
+	if f := r.MoistureForecast; f != nil {
+		forecast := *f
+		e.MoistureForecast = &forecast
+	} else if r.Measurement != nil && r.Measurement.Moisture != nil {
+		// the forecaster drops the forecast, e.g. after watering
+		e.MoistureForecast = nil
+	}
+}
+
+// Sensors returns a copy of all sensors sorted by their address. The recent
+// values are only included if withHistory is set.
+func (s *Store) Sensors(withHistory bool) []Sensor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Sensor, 0, len(s.sensors))
+	for _, e := range s.sensors {
+		result = append(result, e.copy(withHistory))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return key(result[i].Address) < key(result[j].Address)
+	})
+	return result
+}
+
+// Sensor returns a copy of the sensor with the given address. The recent
+// values are only included if withHistory is set.
+func (s *Store) Sensor(address string, withHistory bool) (Sensor, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.sensors[key(address)]
+	if !ok {
+		return Sensor{}, false
+	}
+	return e.copy(withHistory), true
+}
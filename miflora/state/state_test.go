@@ -0,0 +1,109 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func TestStore(t *testing.T) {
+	s := New().WithLabels(func(address, name string) map[string]string {
+		return map[string]string{"name": name}
+	})
+
+	ts := time.Unix(1600000000, 0)
+	moisture := uint8(42)
+	s.ObserveAdvertisement("C4:7C:8D:AA:BB:CC", "fern", ts, -71, 12)
+	s.ObserveResult(&model.Result{
+		Name:        "fern",
+		Address:     "C4:7C:8D:AA:BB:CC",
+		Timestamp:   &ts,
+		Measurement: &model.Measurement{Moisture: &moisture},
+	})
+	s.ObserveAdvertisement("c4:7c:8d:00:00:01", "", ts, -90, 1)
+
+	sensors := s.Sensors(false)
+	assert.Len(t, sensors, 2)
+	assert.Equal(t, "c4:7c:8d:00:00:01", sensors[0].Address)
+
+	sensor, ok := s.Sensor("c4:7c:8d:aa:bb:cc", false)
+	assert.True(t, ok)
+	assert.Equal(t, "fern", sensor.Name)
+	assert.Equal(t, map[string]string{"name": "fern"}, sensor.Labels)
+	assert.Equal(t, -71, *sensor.RSSI)
+	assert.Equal(t, uint8(12), *sensor.FrameCounter)
+	assert.Equal(t, Value{Value: 42, Timestamp: ts}, sensor.Measurements[model.FieldMoisture])
+	assert.Nil(t, sensor.Firmware)
+	assert.Nil(t, sensor.History)
+
+	// modifying a copy doesn't change the store
+	sensor.Measurements[model.FieldMoisture] = Value{}
+	sensor, _ = s.Sensor("c4:7c:8d:aa:bb:cc", false)
+	assert.Equal(t, float64(42), sensor.Measurements[model.FieldMoisture].Value)
+
+	_, ok = s.Sensor("c4:7c:8d:00:00:02", false)
+	assert.False(t, ok)
+}
+
+func TestStoreHistory(t *testing.T) {
+	s := New().WithHistorySize(3)
+
+	ts := time.Unix(1600000000, 0)
+	for i := 0; i < 5; i++ {
+		moisture := uint8(10 + i)
+		t := ts.Add(time.Duration(i) * time.Minute)
+		s.ObserveResult(&model.Result{
+			Address:     "c4:7c:8d:aa:bb:cc",
+			Timestamp:   &t,
+			Measurement: &model.Measurement{Moisture: &moisture},
+		})
+	}
+
+	sensor, ok := s.Sensor("c4:7c:8d:aa:bb:cc", true)
+	assert.True(t, ok)
+	assert.Equal(t, []Value{
+		{Value: 12, Timestamp: ts.Add(2 * time.Minute)},
+		{Value: 13, Timestamp: ts.Add(3 * time.Minute)},
+		{Value: 14, Timestamp: ts.Add(4 * time.Minute)},
+	}, sensor.History[model.FieldMoisture])
+}
+
+func TestStoreMoistureForecast(t *testing.T) {
+	s := New()
+
+	ts := time.Unix(1600000000, 0)
+	observe := func(r *model.Result) *model.MoistureForecast {
+		r.Address = "c4:7c:8d:aa:bb:cc"
+		s.ObserveResult(r)
+		sensor, ok := s.Sensor(r.Address, false)
+		assert.True(t, ok)
+		return sensor.MoistureForecast
+	}
+
+	// declining moisture is forecasted
+	moisture := uint8(30)
+	forecast := &model.MoistureForecast{Threshold: 15, Rate: -0.5, ThresholdCrossing: ts.Add(30 * time.Hour)}
+	assert.Equal(t, forecast, observe(&model.Result{
+		Timestamp:        &ts,
+		Measurement:      &model.Measurement{Moisture: &moisture},
+		MoistureForecast: forecast,
+	}))
+
+	// results without moisture keep the forecast
+	assert.Equal(t, forecast, observe(&model.Result{
+		Timestamp: &ts,
+		Firmware:  &model.Firmware{Version: "3.2.1"},
+	}))
+
+	// after watering the forecaster drops the forecast
+	watered := ts.Add(time.Hour)
+	moisture = 50
+	assert.Nil(t, observe(&model.Result{
+		Timestamp:   &watered,
+		Measurement: &model.Measurement{Moisture: &moisture},
+		Watering:    &model.WateringEvent{Timestamp: watered},
+	}))
+}
@@ -0,0 +1,91 @@
+package miflora
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+const (
+	apiStreamPath = "/api/v1/stream"
+
+	// streamKeepAlive is the interval in which comments are sent to idle
+	// clients
+	streamKeepAlive = 15 * time.Second
+)
+
+// newStreamFilter parses the filter from the address and measurement
+// parameters.
+func newStreamFilter(r *http.Request) (Filter, error) {
+	var f Filter
+	q := r.URL.Query()
+	for _, v := range q["address"] {
+		f.Addresses = append(f.Addresses, strings.Split(v, ",")...)
+	}
+	for _, v := range q["measurement"] {
+		for _, field := range strings.Split(v, ",") {
+			switch field {
+			case model.FieldTemperature, model.FieldMoisture, model.FieldBrightness, model.FieldConductivity:
+			default:
+				return f, fmt.Errorf("unknown measurement type '%s'", field)
+			}
+			f.Measurements = append(f.Measurements, field)
+		}
+	}
+	return f, nil
+}
+
+// apiStreamHandler pushes decoded advertisements as server-sent events.
+// Advertisements can be filtered using the address and measurement
+// parameters.
+func apiStreamHandler(b *broadcaster) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := newStreamFilter(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, &apiError{Error: err.Error()})
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeJSON(w, http.StatusInternalServerError, &apiError{Error: "streaming not supported"})
+			return
+		}
+
+		advCh, unsubscribe := b.subscribeChan(filter)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case a := <-advCh:
+				data, err := json.Marshal(a)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: advertisement\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
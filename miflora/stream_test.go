@@ -0,0 +1,100 @@
+package miflora
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func TestStreamFilter(t *testing.T) {
+	moisture := uint8(30)
+	adv := &model.Advertisement{
+		Address:     "c4:7c:8d:aa:bb:cc",
+		Measurement: &model.Measurement{Moisture: &moisture},
+	}
+
+	for _, tc := range []struct {
+		query   string
+		matches bool
+		err     bool
+	}{
+		{query: "", matches: true},
+		{query: "address=C4:7C:8D:AA:BB:CC", matches: true},
+		{query: "address=c4:7c:8d:00:00:00", matches: false},
+		{query: "address=c4:7c:8d:00:00:00,c4:7c:8d:aa:bb:cc", matches: true},
+		{query: "measurement=moisture", matches: true},
+		{query: "measurement=temperature", matches: false},
+		{query: "measurement=temperature&measurement=moisture", matches: true},
+		{query: "measurement=humidity", err: true},
+	} {
+		f, err := newStreamFilter(httptest.NewRequest(http.MethodGet, apiStreamPath+"?"+tc.query, nil))
+		if tc.err {
+			if err == nil {
+				t.Errorf("expected error for query %q", tc.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for query %q: %v", tc.query, err)
+			continue
+		}
+		if exp, act := tc.matches, f.Matches(adv); exp != act {
+			t.Errorf("unexpected match for query %q exp: %v, act: %v", tc.query, exp, act)
+		}
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	b := newBroadcaster()
+	srv := httptest.NewServer(apiStreamHandler(b))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?address=c4:7c:8d:aa:bb:cc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if exp, act := "text/event-stream", resp.Header.Get("Content-Type"); exp != act {
+		t.Errorf("unexpected content type exp: %v, act: %v", exp, act)
+	}
+
+	// wait for the subscription
+	for i := 0; ; i++ {
+		b.mu.Lock()
+		n := len(b.subscribers)
+		b.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if i > 100 {
+			t.Fatal("client didn't subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.publish(&model.Advertisement{Address: "c4:7c:8d:00:00:00", FrameCounter: 1})
+	b.publish(&model.Advertisement{Address: "c4:7c:8d:aa:bb:cc", FrameCounter: 2})
+
+	r := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	if exp, act := "event: advertisement", lines[0]; exp != act {
+		t.Errorf("unexpected event exp: %v, act: %v", exp, act)
+	}
+	if !strings.Contains(lines[1], `"address":"c4:7c:8d:aa:bb:cc"`) || !strings.Contains(lines[1], `"frame_counter":2`) {
+		t.Errorf("unexpected data: %v", lines[1])
+	}
+}
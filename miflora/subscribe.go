@@ -0,0 +1,261 @@
+package miflora
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/advertisements"
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+// subscriptionBufferSize is the number of advertisements buffered per
+// subscription channel, before advertisements are dropped for slow
+// consumers
+const subscriptionBufferSize = 64
+
+// Filter selects advertisements by address and/or measurement type. Empty
+// fields match all advertisements.
+type Filter struct {
+	Addresses []string
+	// Measurements are the measurement fields, of which at least one needs
+	// to be contained in the advertisement.
+	Measurements []string
+}
+
+// Matches returns true if the advertisement is selected by the filter.
+func (f Filter) Matches(a *model.Advertisement) bool {
+	if len(f.Addresses) > 0 {
+		found := false
+		for _, address := range f.Addresses {
+			if strings.EqualFold(address, a.Address) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Measurements) > 0 {
+		if a.Measurement == nil {
+			return false
+		}
+		values := a.Measurement.Values()
+		found := false
+		for _, field := range f.Measurements {
+			if _, ok := values[field]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+type subscription struct {
+	filter Filter
+	f      func(*model.Advertisement)
+}
+
+// broadcaster distributes advertisements to all subscribers.
+type broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[*subscription]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{
+		subscribers: make(map[*subscription]struct{}),
+	}
+}
+
+// subscribe calls f for all published advertisements matching the filter.
+// The returned function needs to be called to unsubscribe, f is not called
+// after it returned.
+func (b *broadcaster) subscribe(filter Filter, f func(*model.Advertisement)) func() {
+	s := &subscription{filter: filter, f: f}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		delete(b.subscribers, s)
+		b.mu.Unlock()
+	}
+}
+
+// subscribeChan returns a channel receiving the published advertisements
+// matching the filter, advertisements are dropped for slow consumers. The
+// returned function unsubscribes and closes the channel.
+func (b *broadcaster) subscribeChan(filter Filter) (<-chan *model.Advertisement, func()) {
+	ch := make(chan *model.Advertisement, subscriptionBufferSize)
+	unsubscribe := b.subscribe(filter, func(a *model.Advertisement) {
+		select {
+		case ch <- a:
+		default:
+		}
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			unsubscribe()
+			close(ch)
+		})
+	}
+}
+
+// publish hands the advertisement to all matching subscribers.
+func (b *broadcaster) publish(a *model.Advertisement) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if s.filter.Matches(a) {
+			s.f(a)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the decoded advertisements matching
+// the filter, which are received by a running Listen or Exporter. Any number
+// of subscribers can attach to the same scan. Advertisements are dropped if
+// the consumer falls behind, the channel is closed once the context is
+// canceled.
+func (m *MiFlora) Subscribe(ctx context.Context, filter Filter) <-chan *model.Advertisement {
+	ch, unsubscribe := m.events.subscribeChan(filter)
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+	return ch
+}
+
+// SubscribeFunc calls f for every decoded advertisement matching the filter,
+// until the context is canceled. f is called by the scan and blocks it, so
+// it should return quickly.
+func (m *MiFlora) SubscribeFunc(ctx context.Context, filter Filter, f func(*model.Advertisement)) {
+	unsubscribe := m.events.subscribe(filter, f)
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+}
+
+// Listen scans for advertisements of sensors and hands them to the
+// subscribers, until the context is canceled. Frames received more than
+// once are only handed over once. Measurements are passed through the
+// processors before, so subscribers receive calibrated values.
+func (m *MiFlora) Listen(ctx context.Context) error {
+	return m.listen(ctx, nil, nil)
+}
+
+// listen hands the advertisements to the subscribers, observe is called with
+// the results of the processors, if it isn't nil.
+func (m *MiFlora) listen(ctx context.Context, health *health, observe func([]*model.Result)) error {
+	sensorsCh := make(chan *Sensor)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for s := range sensorsCh {
+			health.observeAdvertisement(s.receivedAt)
+			for _, adv := range m.decode(s) {
+				if m.observeFrame(adv) {
+					continue
+				}
+				results := m.process(adv)
+				m.events.publish(adv)
+				if observe != nil && len(results) > 0 {
+					observe(results)
+				}
+			}
+		}
+	}()
+
+	err := m.scanWithRecovery(ctx, health, sensorsCh)
+	close(sensorsCh)
+	<-done
+	return err
+}
+
+// process passes the measurement of the advertisement through the
+// processors and replaces it with the processed one. It returns the results
+// of the processors, which include derived results.
+func (m *MiFlora) process(adv *model.Advertisement) []*model.Result {
+	if adv.Measurement == nil {
+		return nil
+	}
+
+	timestamp := adv.Timestamp
+	r := &model.Result{
+		Name:        adv.Name,
+		Address:     adv.Address,
+		Timestamp:   &timestamp,
+		Measurement: adv.Measurement,
+	}
+	results := m.processors.Process(r)
+	for _, result := range results {
+		if result == r {
+			adv.Measurement = r.Measurement
+		}
+	}
+	return results
+}
+
+// decode parses the service data of an advertisement received from the
+// sensor. Frames failing to parse are counted and skipped.
+func (m *MiFlora) decode(s *Sensor) []*model.Advertisement {
+	var result []*model.Advertisement
+	for _, serviceData := range s.advertisement.ServiceData() {
+		data, err := advertisements.New(serviceData.Data)
+		if err != nil {
+			m.metrics.observeParseError(err)
+			_ = level.Error(s.logger).Log("err", err)
+			continue
+		}
+		adv := &model.Advertisement{
+			Name:         s.name,
+			Address:      s.advertisement.Addr().String(),
+			Timestamp:    s.receivedAt,
+			RSSI:         s.advertisement.RSSI(),
+			ProductID:    data.ProductID(),
+			FrameCounter: data.FrameCounter(),
+		}
+		if data.HasCapabilities() {
+			capabilities := data.Capabilities()
+			adv.Capabilities = &capabilities
+		}
+
+		if data.HasMeasurement() {
+			measurementID, err := data.MeasurementID()
+			if err != nil {
+				m.metrics.observeParseError(err)
+				_ = level.Error(s.logger).Log("err", err)
+				continue
+			}
+			measurement, err := data.Measurement()
+			if err != nil {
+				m.metrics.observeParseError(err)
+				_ = level.Error(s.logger).Log("err", err)
+				continue
+			}
+			adv.MeasurementID = &measurementID
+			adv.Measurement = measurement
+		}
+		result = append(result, adv)
+	}
+	return result
+}
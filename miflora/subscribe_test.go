@@ -0,0 +1,126 @@
+package miflora
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/go-kit/kit/log"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	"github.com/simonswine/mi-flora-exporter/miflora/pipeline"
+)
+
+func TestDecode(t *testing.T) {
+	moisture, err := hex.DecodeString("71209800d8795d658d7cc40d0810010d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adv := newFakeAdvertisement("c4:7c:8d:65:5d:79")
+	adv.serviceData = []ble.ServiceData{
+		{Data: moisture},
+		{Data: []byte{0x00}},
+	}
+	now := time.Now()
+	s := &Sensor{logger: log.NewNopLogger(), advertisement: adv, receivedAt: now, name: "my-plant"}
+
+	advs := (&MiFlora{}).decode(s)
+	if exp, act := 1, len(advs); exp != act {
+		t.Fatalf("unexpected number of advertisements exp: %d, act: %d", exp, act)
+	}
+	a := advs[0]
+	if a.Name != "my-plant" || a.Address != "c4:7c:8d:65:5d:79" || a.RSSI != 66 || !a.Timestamp.Equal(now) {
+		t.Errorf("unexpected advertisement: %+v", a)
+	}
+	if exp, act := uint16(0x0098), a.ProductID; exp != act {
+		t.Errorf("unexpected product id exp: %#x, act: %#x", exp, act)
+	}
+	if exp, act := uint8(0xd8), a.FrameCounter; exp != act {
+		t.Errorf("unexpected frame counter exp: %#x, act: %#x", exp, act)
+	}
+	if a.Capabilities == nil || *a.Capabilities != 0x0d {
+		t.Errorf("unexpected capabilities: %v", a.Capabilities)
+	}
+	if a.MeasurementID == nil || *a.MeasurementID != 0x1008 {
+		t.Errorf("unexpected measurement id: %v", a.MeasurementID)
+	}
+	if a.Measurement == nil || a.Measurement.Moisture == nil || *a.Measurement.Moisture != 13 {
+		t.Errorf("unexpected measurement: %+v", a.Measurement)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	m := &MiFlora{events: newBroadcaster()}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	all := m.Subscribe(ctx, Filter{})
+	filtered := m.Subscribe(ctx, Filter{Addresses: []string{"C4:7C:8D:AA:BB:CC"}})
+	var received []*model.Advertisement
+	m.SubscribeFunc(ctx, Filter{}, func(a *model.Advertisement) {
+		received = append(received, a)
+	})
+
+	m.events.publish(&model.Advertisement{Address: "c4:7c:8d:00:00:00", FrameCounter: 1})
+	m.events.publish(&model.Advertisement{Address: "c4:7c:8d:aa:bb:cc", FrameCounter: 2})
+
+	for _, exp := range []uint8{1, 2} {
+		if act := (<-all).FrameCounter; exp != act {
+			t.Errorf("unexpected frame counter exp: %d, act: %d", exp, act)
+		}
+	}
+	if exp, act := uint8(2), (<-filtered).FrameCounter; exp != act {
+		t.Errorf("unexpected frame counter exp: %d, act: %d", exp, act)
+	}
+	if exp, act := 2, len(received); exp != act {
+		t.Errorf("unexpected number of advertisements exp: %d, act: %d", exp, act)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-all:
+		if ok {
+			t.Error("unexpected advertisement after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
+
+// offsetMoisture adds to the moisture and derives a result without
+// measurement.
+type offsetMoisture uint8
+
+func (o offsetMoisture) Process(r *model.Result) []*model.Result {
+	moisture := *r.Measurement.Moisture + uint8(o)
+	r.Measurement = &model.Measurement{Moisture: &moisture}
+	return []*model.Result{r, {Address: r.Address, Species: "fern"}}
+}
+
+func TestProcess(t *testing.T) {
+	m := &MiFlora{events: newBroadcaster(), processors: pipeline.Pipeline{offsetMoisture(5)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.Subscribe(ctx, Filter{})
+
+	moisture := uint8(13)
+	adv := &model.Advertisement{Address: "c4:7c:8d:aa:bb:cc", Measurement: &model.Measurement{Moisture: &moisture}}
+	results := m.process(adv)
+	m.events.publish(adv)
+
+	if exp, act := 2, len(results); exp != act {
+		t.Fatalf("unexpected number of results exp: %d, act: %d", exp, act)
+	}
+	if exp, act := uint8(18), *(<-ch).Measurement.Moisture; exp != act {
+		t.Errorf("unexpected published moisture exp: %d, act: %d", exp, act)
+	}
+	if exp, act := uint8(13), moisture; exp != act {
+		t.Errorf("unexpected raw moisture exp: %d, act: %d", exp, act)
+	}
+
+	// advertisements without measurement aren't processed
+	if results := m.process(&model.Advertisement{Address: "c4:7c:8d:aa:bb:cc"}); len(results) != 0 {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
@@ -0,0 +1,231 @@
+package watering
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+	mprom "github.com/simonswine/mi-flora-exporter/outputs/prometheus"
+)
+
+// Config controls when an increase of moisture is considered a watering.
+type Config struct {
+	// MinIncrease is the increase of moisture in percentage points required.
+	MinIncrease float64
+	// Window is the time span in which the increase needs to happen.
+	Window time.Duration
+	// Debounce is the minimum time between two waterings.
+	Debounce time.Duration
+}
+
+// DefaultConfig returns the default configuration.
+func DefaultConfig() Config {
+	return Config{
+		MinIncrease: 10,
+		Window:      2 * time.Hour,
+		Debounce:    6 * time.Hour,
+	}
+}
+
+// daysKept is the number of days with watering counts kept per sensor.
+const daysKept = 7
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+type sensor struct {
+	name    string
+	address string
+
+	// samples within the window of the last observed sample
+	samples []sample
+	// events detected, used for debouncing
+	events []time.Time
+	// number of waterings per day
+	days map[string]int
+
+	lastWatered time.Time
+	total       uint64
+}
+
+func day(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// Detector detects waterings by sharp increases of the moisture. It handles
+// results in chronological order as well as in reverse order, as it is the
+// case for history downloads. It implements pipeline.Processor and
+// prometheus.Collector.
+type Detector struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	sensors map[string]*sensor
+
+	lastWatered    *prometheus.Desc
+	wateringsToday *prometheus.Desc
+	waterings      *prometheus.Desc
+}
+
+func New(cfg Config) *Detector {
+	return &Detector{
+		cfg:            cfg,
+		now:            time.Now,
+		sensors:        make(map[string]*sensor),
+		lastWatered:    mprom.NewDesc(prometheus.Opts(mprom.MetricOptsLastWatered)),
+		wateringsToday: mprom.NewDesc(prometheus.Opts(mprom.MetricOptsWateringsToday)),
+		waterings:      mprom.NewDesc(prometheus.Opts(mprom.MetricOptsWaterings)),
+	}
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// observe adds a sample and returns a watering event if one is detected.
+func (d *Detector) observe(s *sensor, c sample) *model.WateringEvent {
+	// keep only samples within the window of the current one
+	samples := s.samples[:0]
+	for _, e := range s.samples {
+		if abs(e.t.Sub(c.t)) <= d.cfg.Window {
+			samples = append(samples, e)
+		}
+	}
+
+	// find the biggest increase involving the current sample
+	var before, after *sample
+	for pos := range samples {
+		e := &samples[pos]
+		var b, a *sample
+		switch {
+		case e.t.Before(c.t):
+			b, a = e, &c
+		case e.t.After(c.t):
+			b, a = &c, e
+		default:
+			continue
+		}
+		if before == nil || a.v-b.v > after.v-before.v {
+			before, after = b, a
+		}
+	}
+	s.samples = append(samples, c)
+
+	if before == nil || after.v-before.v < d.cfg.MinIncrease {
+		return nil
+	}
+
+	// debounce events
+	events := s.events[:0]
+	for _, t := range s.events {
+		if abs(t.Sub(c.t)) <= d.cfg.Debounce+d.cfg.Window {
+			events = append(events, t)
+		}
+	}
+	s.events = events
+	for _, t := range s.events {
+		if abs(t.Sub(after.t)) < d.cfg.Debounce {
+			return nil
+		}
+	}
+	s.events = append(s.events, after.t)
+
+	// count waterings per day
+	s.days[day(after.t)]++
+	if len(s.days) > daysKept {
+		days := make([]string, 0, len(s.days))
+		for k := range s.days {
+			days = append(days, k)
+		}
+		sort.Strings(days)
+		for _, k := range days[:len(days)-daysKept] {
+			delete(s.days, k)
+		}
+	}
+
+	s.total++
+	if after.t.After(s.lastWatered) {
+		s.lastWatered = after.t
+	}
+
+	return &model.WateringEvent{
+		Timestamp:      after.t,
+		MoistureBefore: before.v,
+		MoistureAfter:  after.v,
+		WateringsOnDay: s.days[day(after.t)],
+	}
+}
+
+// Process implements pipeline.Processor. Detected waterings are added as
+// additional results.
+func (d *Detector) Process(r *model.Result) []*model.Result {
+	results := []*model.Result{r}
+	if r.Measurement == nil || r.Measurement.Moisture == nil {
+		return results
+	}
+
+	t := d.now()
+	if r.Timestamp != nil {
+		t = *r.Timestamp
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := strings.ToLower(r.Address)
+	s, ok := d.sensors[key]
+	if !ok {
+		s = &sensor{
+			address: r.Address,
+			days:    make(map[string]int),
+		}
+		d.sensors[key] = s
+	}
+	s.name = r.Name
+
+	event := d.observe(s, sample{t: t, v: float64(*r.Measurement.Moisture)})
+	if event == nil {
+		return results
+	}
+
+	return append(results, &model.Result{
+		Name:      r.Name,
+		Address:   r.Address,
+		Timestamp: &event.Timestamp,
+		Species:   r.Species,
+		Watering:  event,
+	})
+}
+
+// Describe implements prometheus.Collector.
+func (d *Detector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.lastWatered
+	ch <- d.wateringsToday
+	ch <- d.waterings
+}
+
+// Collect implements prometheus.Collector.
+func (d *Detector) Collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	today := day(d.now())
+	for _, s := range d.sensors {
+		lv := []string{s.address, s.name}
+		if !s.lastWatered.IsZero() {
+			ch <- prometheus.MustNewConstMetric(d.lastWatered, prometheus.GaugeValue, float64(s.lastWatered.Unix()), lv...)
+		}
+		ch <- prometheus.MustNewConstMetric(d.wateringsToday, prometheus.GaugeValue, float64(s.days[today]), lv...)
+		ch <- prometheus.MustNewConstMetric(d.waterings, prometheus.CounterValue, float64(s.total), lv...)
+	}
+}
@@ -0,0 +1,86 @@
+package watering
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func result(t time.Time, moisture uint8) *model.Result {
+	return &model.Result{
+		Name:        "fern",
+		Address:     "c4:7c:8d:aa:bb:cc",
+		Timestamp:   &t,
+		Measurement: &model.Measurement{Moisture: &moisture},
+	}
+}
+
+func events(d *Detector, start time.Time, step time.Duration, values ...uint8) []*model.WateringEvent {
+	var events []*model.WateringEvent
+	for pos, v := range values {
+		for _, r := range d.Process(result(start.Add(time.Duration(pos)*step), v)) {
+			if r.Watering != nil {
+				events = append(events, r.Watering)
+			}
+		}
+	}
+	return events
+}
+
+func TestDetector(t *testing.T) {
+	start := time.Date(2021, 5, 1, 8, 0, 0, 0, time.Local)
+
+	t.Run("chronological", func(t *testing.T) {
+		d := New(DefaultConfig())
+		e := events(d, start, 30*time.Minute, 20, 19, 19, 25, 38, 37)
+		require.Len(t, e, 1)
+		assert.Equal(t, start.Add(2*time.Hour), e[0].Timestamp)
+		assert.Equal(t, 19.0, e[0].MoistureBefore)
+		assert.Equal(t, 38.0, e[0].MoistureAfter)
+		assert.Equal(t, 1, e[0].WateringsOnDay)
+	})
+
+	t.Run("reverse chronological", func(t *testing.T) {
+		d := New(DefaultConfig())
+		e := events(d, start.Add(5*30*time.Minute), -30*time.Minute, 37, 38, 25, 19, 19, 20)
+		require.Len(t, e, 1)
+		assert.Equal(t, start.Add(2*time.Hour), e[0].Timestamp)
+		assert.Equal(t, 38.0, e[0].MoistureAfter)
+	})
+
+	t.Run("slow increase is ignored", func(t *testing.T) {
+		d := New(DefaultConfig())
+		assert.Empty(t, events(d, start, time.Hour, 20, 23, 26, 29, 32, 35))
+	})
+
+	t.Run("debounce", func(t *testing.T) {
+		d := New(DefaultConfig())
+		e := events(d, start, time.Hour, 20, 35, 30, 45, 40, 40, 40, 40, 40, 40, 30, 45)
+		require.Len(t, e, 2)
+		assert.Equal(t, start.Add(time.Hour), e[0].Timestamp)
+		assert.Equal(t, start.Add(11*time.Hour), e[1].Timestamp)
+		assert.Equal(t, 2, e[1].WateringsOnDay)
+	})
+}
+
+func TestDetectorMetrics(t *testing.T) {
+	start := time.Date(2021, 5, 1, 8, 0, 0, 0, time.Local)
+	d := New(DefaultConfig())
+	d.now = func() time.Time { return start.Add(12 * time.Hour) }
+	events(d, start, time.Hour, 20, 35)
+
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(`
+# HELP flowercare_waterings_today Number of waterings detected today.
+# TYPE flowercare_waterings_today gauge
+flowercare_waterings_today{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 1
+# HELP flowercare_waterings_total Total number of waterings detected.
+# TYPE flowercare_waterings_total counter
+flowercare_waterings_total{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 1
+`), "flowercare_waterings_today", "flowercare_waterings_total"))
+}
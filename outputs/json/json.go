@@ -12,14 +12,44 @@ import (
 
 type JSON struct {
 	logger log.Logger
+	units  model.Units
 }
 
 func New(logger log.Logger) *JSON {
 	return &JSON{
 		logger: logger,
+		units:  model.DefaultUnits(),
 	}
 }
 
+// WithUnits selects the units of the measurements.
+func (j *JSON) WithUnits(u model.Units) *JSON {
+	j.units = u
+	return j
+}
+
+// result replaces the measurements with ones carrying explicit units.
+type unitResult struct {
+	*model.Result
+	Measurement    *model.UnitMeasurement `json:"measurement,omitempty"`
+	RawMeasurement *model.UnitMeasurement `json:"raw_measurement,omitempty"`
+	Conditions     []model.Condition      `json:"conditions,omitempty"`
+}
+
+func (j *JSON) result(r *model.Result) *unitResult {
+	out := &unitResult{Result: r}
+	if r.Measurement != nil {
+		out.Measurement = r.Measurement.In(j.units)
+	}
+	if r.RawMeasurement != nil {
+		out.RawMeasurement = r.RawMeasurement.In(j.units)
+	}
+	for _, c := range r.Conditions {
+		out.Conditions = append(out.Conditions, j.units.ConvertCondition(c))
+	}
+	return out
+}
+
 func (j *JSON) Run(ctx context.Context, w io.Writer) (chan *model.Result, chan error, error) {
 	resultsCh := make(chan *model.Result)
 	errCh := make(chan error)
@@ -30,7 +60,7 @@ func (j *JSON) Run(ctx context.Context, w io.Writer) (chan *model.Result, chan e
 		defer close(errCh)
 
 		for result := range resultsCh {
-			if err := enc.Encode(result); err != nil {
+			if err := enc.Encode(j.result(result)); err != nil {
 				errCh <- err
 				break
 			}
@@ -1,8 +1,11 @@
 package prometheus
 
 import (
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/simonswine/mi-flora-exporter/miflora/model"
 )
@@ -13,9 +16,12 @@ const (
 	// MetricPrefix contains the prefix used by all metrics emitted from this collector.
 	Namespace = "flowercare"
 
-	LabelAddress = "macaddress"
-	LabelName    = "name"
-	LabelVersion = "version"
+	LabelAddress   = "macaddress"
+	LabelName      = "name"
+	LabelVersion   = "version"
+	LabelSpecies   = "species"
+	LabelDimension = "dimension"
+	LabelState     = "state"
 )
 
 var (
@@ -63,48 +69,414 @@ var (
 		Name:      "last_adv_timestamp", // do not name this advertisement as that is blocked by adblockers
 		Help:      "Contains the timestamp when the last advertisement from the sensor was received by the Bluetooth device.",
 	}
+	MetricOptsPlantInfo = prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "plant_info",
+		Help:      "Contains the plant species the sensor is assigned to.",
+	}
+	MetricOptsCondition = prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "condition",
+		Help:      "State of a measured dimension compared to the thresholds of the plant species, 1 for the current state.",
+	}
+	MetricOptsLastWatered = prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "last_watered_timestamp",
+		Help:      "Contains the timestamp of the last watering detected by a sharp increase of moisture.",
+	}
+	MetricOptsWateringsToday = prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "waterings_today",
+		Help:      "Number of waterings detected today.",
+	}
+	MetricOptsWaterings = prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "waterings_total",
+		Help:      "Total number of waterings detected.",
+	}
+	MetricOptsDailyLightIntegral = prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "daily_light_integral_moles_per_square_meter",
+		Help:      "Photosynthetic light received in the last 24 hours, estimated from the brightness.",
+	}
+	MetricOptsLightHours = prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "light_hours",
+		Help:      "Hours with a brightness above the threshold in the last 24 hours.",
+	}
+	MetricOptsMoisturePredictedThresholdCrossing = prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "moisture_predicted_threshold_crossing_timestamp",
+		Help:      "Contains the timestamp when the moisture is predicted to fall below the minimum of the plant species.",
+	}
 )
 
-type Metrics struct {
-	Info         *prometheus.GaugeVec
-	Battery      *prometheus.GaugeVec
-	Conductivity *prometheus.GaugeVec
-	Brightness   *prometheus.GaugeVec
-	Moisture     *prometheus.GaugeVec
-	Temperature  *prometheus.GaugeVec
-	RSSI         *prometheus.HistogramVec
-	LastAdv      *prometheus.GaugeVec
+// MetricOptsMeasurement returns the options of the metric of a measurement
+// field. The name of the metric contains the selected unit.
+func MetricOptsMeasurement(field string, u model.Units) prometheus.GaugeOpts {
+	switch field {
+	case model.FieldTemperature:
+		o := MetricOptsTemperature
+		switch u.Temperature {
+		case model.Fahrenheit:
+			o.Name = "temperature_fahrenheit"
+			o.Help = "Ambient temperature in fahrenheit."
+		case model.Kelvin:
+			o.Name = "temperature_kelvin"
+			o.Help = "Ambient temperature in kelvin."
+		}
+		return o
+	case model.FieldConductivity:
+		o := MetricOptsConductivity
+		if u.Conductivity == model.MicrosiemensPerCentimeter {
+			o.Name = "conductivity_us_cm"
+			o.Help = "Soil conductivity in microsiemens/centimeter."
+		}
+		return o
+	case model.FieldBrightness:
+		o := MetricOptsBrightness
+		if u.Brightness == model.FootCandles {
+			o.Name = "brightness_foot_candles"
+			o.Help = "Ambient lighting in foot-candles."
+		}
+		return o
+	}
+	return MetricOptsMoisture
+}
+
+// MetricOptsThresholdMin returns the options of the metric of the minimum
+// value of a measurement field preferred by the plant species. Like the
+// measurement, the name of the metric contains the selected unit.
+func MetricOptsThresholdMin(field string, u model.Units) prometheus.GaugeOpts {
+	o := MetricOptsMeasurement(field, u)
+	o.Name = "threshold_min_" + o.Name
+	o.Help = "Minimum preferred by the plant species. " + o.Help
+	return o
+}
+
+// MetricOptsThresholdMax returns the options of the metric of the maximum
+// value of a measurement field preferred by the plant species. Like the
+// measurement, the name of the metric contains the selected unit.
+func MetricOptsThresholdMax(field string, u model.Units) prometheus.GaugeOpts {
+	o := MetricOptsMeasurement(field, u)
+	o.Name = "threshold_max_" + o.Name
+	o.Help = "Maximum preferred by the plant species. " + o.Help
+	return o
 }
 
-func (m *Metrics) ObserveRSSI(v float64, labelValues ...string) {
-	m.RSSI.WithLabelValues(labelValues...).Observe(v)
-	m.LastAdv.WithLabelValues(labelValues...).SetToCurrentTime()
+// thresholdFields contains the measurement fields with thresholds.
+var thresholdFields = []string{
+	model.FieldBrightness,
+	model.FieldConductivity,
+	model.FieldMoisture,
+	model.FieldTemperature,
 }
 
-func (m *Metrics) ObserveMeasurement(v *model.Measurement, labelValues ...string) {
-	if v.Temperature != nil {
-		m.Temperature.WithLabelValues(labelValues...).Set(v.Temperature.Value())
+func newThresholdDescs(opts func(string, model.Units) prometheus.GaugeOpts, u model.Units) map[string]*prometheus.Desc {
+	descs := make(map[string]*prometheus.Desc, len(thresholdFields))
+	for _, field := range thresholdFields {
+		descs[field] = NewDesc(prometheus.Opts(opts(field, u)))
 	}
-	if v.Conductivity != nil {
-		m.Conductivity.WithLabelValues(labelValues...).Set(v.Conductivity.Value())
+	return descs
+}
+
+// Labels returns the labels every series of a sensor contains.
+func Labels(address, name string) map[string]string {
+	return map[string]string{
+		LabelAddress: address,
+		LabelName:    name,
 	}
-	if v.Brightness != nil {
-		m.Brightness.WithLabelValues(labelValues...).Set(float64(*v.Brightness))
+}
+
+// NewDesc returns the description of a metric with the labels every series
+// of a sensor contains and additional labels.
+func NewDesc(o prometheus.Opts, extraLabels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(o.Namespace, o.Subsystem, o.Name),
+		o.Help,
+		append(append([]string{}, defaultLabels...), extraLabels...),
+		o.ConstLabels,
+	)
+}
+
+// sample is a single value together with the time it has been observed.
+type sample struct {
+	v float64
+	t time.Time
+}
+
+// conditionSample is a condition together with the time it has been
+// evaluated.
+type conditionSample struct {
+	c model.Condition
+	t time.Time
+}
+
+// sensorState caches the most recent values seen for a single sensor.
+type sensorState struct {
+	address string
+	name    string
+
+	version      string
+	info         *sample
+	battery      *sample
+	conductivity *sample
+	brightness   *sample
+	moisture     *sample
+	temperature  *sample
+	lastAdv      *sample
+
+	species    string
+	plantInfo  *sample
+	conditions map[string]*conditionSample
+
+	rssiCount   uint64
+	rssiSum     float64
+	rssiBuckets []uint64
+	rssiTime    time.Time
+}
+
+func (s *sensorState) labelValues() []string {
+	return []string{s.address, s.name}
+}
+
+// Collector implements prometheus.Collector. It keeps the last observed
+// values per sensor and exposes them on scrape. Optionally samples are
+// emitted with the timestamp they have been received at, rather than the
+// time of the scrape.
+type Collector struct {
+	mu         sync.Mutex
+	sensors    map[string]*sensorState
+	timestamps bool
+	units      model.Units
+
+	info         *prometheus.Desc
+	battery      *prometheus.Desc
+	conductivity *prometheus.Desc
+	brightness   *prometheus.Desc
+	moisture     *prometheus.Desc
+	temperature  *prometheus.Desc
+	rssi         *prometheus.Desc
+	lastAdv      *prometheus.Desc
+	plantInfo    *prometheus.Desc
+	condition    *prometheus.Desc
+	thresholdMin map[string]*prometheus.Desc
+	thresholdMax map[string]*prometheus.Desc
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		sensors:      make(map[string]*sensorState),
+		units:        model.DefaultUnits(),
+		info:         NewDesc(prometheus.Opts(MetricOptsInfo), LabelVersion),
+		battery:      NewDesc(prometheus.Opts(MetricOptsBattery)),
+		conductivity: NewDesc(prometheus.Opts(MetricOptsConductivity)),
+		brightness:   NewDesc(prometheus.Opts(MetricOptsBrightness)),
+		moisture:     NewDesc(prometheus.Opts(MetricOptsMoisture)),
+		temperature:  NewDesc(prometheus.Opts(MetricOptsTemperature)),
+		rssi: NewDesc(prometheus.Opts{
+			Namespace:   MetricOptsRSSI.Namespace,
+			Subsystem:   MetricOptsRSSI.Subsystem,
+			Name:        MetricOptsRSSI.Name,
+			Help:        MetricOptsRSSI.Help,
+			ConstLabels: MetricOptsRSSI.ConstLabels,
+		}),
+		lastAdv:      NewDesc(prometheus.Opts(MetricLastAdv)),
+		plantInfo:    NewDesc(prometheus.Opts(MetricOptsPlantInfo), LabelSpecies),
+		condition:    NewDesc(prometheus.Opts(MetricOptsCondition), LabelDimension, LabelState),
+		thresholdMin: newThresholdDescs(MetricOptsThresholdMin, model.DefaultUnits()),
+		thresholdMax: newThresholdDescs(MetricOptsThresholdMax, model.DefaultUnits()),
 	}
-	if v.Moisture != nil {
-		m.Moisture.WithLabelValues(labelValues...).Set(float64(*v.Moisture))
+}
+
+// WithTimestamps controls if samples are exposed with the time they have
+// been received.
+func (c *Collector) WithTimestamps(v bool) *Collector {
+	c.timestamps = v
+	return c
+}
+
+// WithUnits selects the units of the measurements and thresholds, the metric
+// names change accordingly.
+func (c *Collector) WithUnits(u model.Units) *Collector {
+	c.units = u
+	c.conductivity = NewDesc(prometheus.Opts(MetricOptsMeasurement(model.FieldConductivity, u)))
+	c.brightness = NewDesc(prometheus.Opts(MetricOptsMeasurement(model.FieldBrightness, u)))
+	c.temperature = NewDesc(prometheus.Opts(MetricOptsMeasurement(model.FieldTemperature, u)))
+	c.thresholdMin = newThresholdDescs(MetricOptsThresholdMin, u)
+	c.thresholdMax = newThresholdDescs(MetricOptsThresholdMax, u)
+	return c
+}
+
+func (c *Collector) sensor(address, name string) *sensorState {
+	s, ok := c.sensors[address]
+	if !ok {
+		s = &sensorState{
+			address:     address,
+			rssiBuckets: make([]uint64, len(MetricOptsRSSI.Buckets)),
+			conditions:  make(map[string]*conditionSample),
+		}
+		c.sensors[address] = s
 	}
+	s.name = name
+	return s
 }
 
-func NewMetrics(r prometheus.Registerer) *Metrics {
-	return &Metrics{
-		Info:         promauto.With(r).NewGaugeVec(MetricOptsInfo, append(defaultLabels, LabelVersion)),
-		Battery:      promauto.With(r).NewGaugeVec(MetricOptsBattery, defaultLabels),
-		Conductivity: promauto.With(r).NewGaugeVec(MetricOptsConductivity, defaultLabels),
-		Brightness:   promauto.With(r).NewGaugeVec(MetricOptsBrightness, defaultLabels),
-		Moisture:     promauto.With(r).NewGaugeVec(MetricOptsMoisture, defaultLabels),
-		Temperature:  promauto.With(r).NewGaugeVec(MetricOptsTemperature, defaultLabels),
-		RSSI:         promauto.With(r).NewHistogramVec(MetricOptsRSSI, defaultLabels),
-		LastAdv:      promauto.With(r).NewGaugeVec(MetricLastAdv, defaultLabels),
+// ObserveRSSI records the signal strength of a received advertisement.
+func (c *Collector) ObserveRSSI(address, name string, t time.Time, v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.sensor(address, name)
+	for i, upperBound := range MetricOptsRSSI.Buckets {
+		if v <= upperBound {
+			s.rssiBuckets[i]++
+		}
+	}
+	s.rssiCount++
+	s.rssiSum += v
+	s.rssiTime = t
+	s.lastAdv = &sample{v: float64(t.UnixNano()) / 1e9, t: t}
+}
+
+// ObserveResult records firmware and measurement values of a result. If the
+// result carries no timestamp the current time is used.
+func (c *Collector) ObserveResult(r *model.Result) {
+	t := time.Now()
+	if r.Timestamp != nil {
+		t = *r.Timestamp
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.sensor(r.Address, r.Name)
+
+	if f := r.Firmware; f != nil {
+		s.version = f.Version
+		s.info = &sample{v: 1.0, t: t}
+		s.battery = &sample{v: float64(f.Battery), t: t}
+	}
+
+	if m := r.Measurement; m != nil {
+		for field, v := range m.ValuesIn(c.units) {
+			switch field {
+			case model.FieldTemperature:
+				s.temperature = &sample{v: v, t: t}
+			case model.FieldConductivity:
+				s.conductivity = &sample{v: v, t: t}
+			case model.FieldBrightness:
+				s.brightness = &sample{v: v, t: t}
+			case model.FieldMoisture:
+				s.moisture = &sample{v: v, t: t}
+			}
+		}
+	}
+
+	if r.Species != "" {
+		s.species = r.Species
+		s.plantInfo = &sample{v: 1.0, t: t}
+	}
+	for _, condition := range r.Conditions {
+		s.conditions[condition.Dimension] = &conditionSample{c: c.units.ConvertCondition(condition), t: t}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.info
+	ch <- c.battery
+	ch <- c.conductivity
+	ch <- c.brightness
+	ch <- c.moisture
+	ch <- c.temperature
+	ch <- c.rssi
+	ch <- c.lastAdv
+	ch <- c.plantInfo
+	ch <- c.condition
+	for _, field := range thresholdFields {
+		ch <- c.thresholdMin[field]
+		ch <- c.thresholdMax[field]
+	}
+}
+
+func (c *Collector) withTimestamp(t time.Time, m prometheus.Metric) prometheus.Metric {
+	if !c.timestamps || t.IsZero() {
+		return m
+	}
+	return prometheus.NewMetricWithTimestamp(t, m)
+}
+
+func (c *Collector) collectGauge(ch chan<- prometheus.Metric, desc *prometheus.Desc, s *sample, labelValues ...string) {
+	if s == nil {
+		return
+	}
+	ch <- c.withTimestamp(s.t, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, s.v, labelValues...))
+}
+
+func (c *Collector) collectConditions(ch chan<- prometheus.Metric, s *sensorState, labelValues ...string) {
+	dimensions := make([]string, 0, len(s.conditions))
+	for dimension := range s.conditions {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+
+	for _, dimension := range dimensions {
+		cs := s.conditions[dimension]
+		lv := append(append([]string{}, labelValues...), dimension)
+		for _, state := range model.ConditionStates {
+			v := 0.0
+			if cs.c.State == state {
+				v = 1.0
+			}
+			c.collectGauge(ch, c.condition, &sample{v: v, t: cs.t}, append(lv, state)...)
+		}
+		if desc, ok := c.thresholdMin[dimension]; ok && cs.c.Min != nil {
+			c.collectGauge(ch, desc, &sample{v: *cs.c.Min, t: cs.t}, labelValues...)
+		}
+		if desc, ok := c.thresholdMax[dimension]; ok && cs.c.Max != nil {
+			c.collectGauge(ch, desc, &sample{v: *cs.c.Max, t: cs.t}, labelValues...)
+		}
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	addresses := make([]string, 0, len(c.sensors))
+	for address := range c.sensors {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		s := c.sensors[address]
+		lv := s.labelValues()
+
+		c.collectGauge(ch, c.info, s.info, append(lv, s.version)...)
+		c.collectGauge(ch, c.battery, s.battery, lv...)
+		c.collectGauge(ch, c.conductivity, s.conductivity, lv...)
+		c.collectGauge(ch, c.brightness, s.brightness, lv...)
+		c.collectGauge(ch, c.moisture, s.moisture, lv...)
+		c.collectGauge(ch, c.temperature, s.temperature, lv...)
+		c.collectGauge(ch, c.lastAdv, s.lastAdv, lv...)
+		c.collectGauge(ch, c.plantInfo, s.plantInfo, append(lv, s.species)...)
+		c.collectConditions(ch, s, lv...)
+
+		if s.rssiCount > 0 {
+			buckets := make(map[float64]uint64, len(s.rssiBuckets))
+			for i, upperBound := range MetricOptsRSSI.Buckets {
+				buckets[upperBound] = s.rssiBuckets[i]
+			}
+			ch <- c.withTimestamp(s.rssiTime, prometheus.MustNewConstHistogram(
+				c.rssi,
+				s.rssiCount,
+				s.rssiSum,
+				buckets,
+				lv...,
+			))
+		}
 	}
 }
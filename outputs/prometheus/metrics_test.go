@@ -0,0 +1,169 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func testResult(t time.Time) *model.Result {
+	temperature := model.Temperature(215)
+	moisture := uint8(34)
+	return &model.Result{
+		Name:      "fern",
+		Address:   "c4:7c:8d:aa:bb:cc",
+		Timestamp: &t,
+		Measurement: &model.Measurement{
+			Temperature: &temperature,
+			Moisture:    &moisture,
+		},
+	}
+}
+
+func TestCollector(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+
+	for _, tc := range []struct {
+		name       string
+		timestamps bool
+		expected   string
+	}{
+		{
+			name: "without timestamps",
+			expected: `
+# HELP flowercare_moisture_percent Soil relative moisture in percent.
+# TYPE flowercare_moisture_percent gauge
+flowercare_moisture_percent{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 34
+# HELP flowercare_temperature_celsius Ambient temperature in celsius.
+# TYPE flowercare_temperature_celsius gauge
+flowercare_temperature_celsius{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 21.5
+`,
+		},
+		{
+			name:       "with timestamps",
+			timestamps: true,
+			expected: `
+# HELP flowercare_moisture_percent Soil relative moisture in percent.
+# TYPE flowercare_moisture_percent gauge
+flowercare_moisture_percent{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 34 1600000000000
+# HELP flowercare_temperature_celsius Ambient temperature in celsius.
+# TYPE flowercare_temperature_celsius gauge
+flowercare_temperature_celsius{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 21.5 1600000000000
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewCollector().WithTimestamps(tc.timestamps)
+			c.ObserveResult(testResult(ts))
+
+			assert.NoError(t, testutil.CollectAndCompare(
+				c,
+				strings.NewReader(tc.expected),
+				"flowercare_moisture_percent",
+				"flowercare_temperature_celsius",
+			))
+		})
+	}
+}
+
+func TestCollectorRSSI(t *testing.T) {
+	c := NewCollector()
+	ts := time.Unix(1600000000, 0)
+	c.ObserveRSSI("c4:7c:8d:aa:bb:cc", "fern", ts, -71)
+	c.ObserveRSSI("c4:7c:8d:aa:bb:cc", "fern", ts.Add(time.Minute), -95)
+
+	assert.NoError(t, testutil.CollectAndCompare(
+		c,
+		strings.NewReader(`
+# HELP flowercare_last_adv_timestamp Contains the timestamp when the last advertisement from the sensor was received by the Bluetooth device.
+# TYPE flowercare_last_adv_timestamp gauge
+flowercare_last_adv_timestamp{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 1.60000006e+09
+# HELP flowercare_signal_strength_rssi Signal strenght of the sensors as reported by the bluetooth adapter.
+# TYPE flowercare_signal_strength_rssi histogram
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-120"} 0
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-110"} 0
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-100"} 0
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-90"} 1
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-80"} 1
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-70"} 2
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-60"} 2
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-50"} 2
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-40"} 2
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-30"} 2
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-20"} 2
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="-10"} 2
+flowercare_signal_strength_rssi_bucket{macaddress="c4:7c:8d:aa:bb:cc",name="fern",le="+Inf"} 2
+flowercare_signal_strength_rssi_sum{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} -166
+flowercare_signal_strength_rssi_count{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 2
+`),
+	))
+}
+
+func TestCollectorConditions(t *testing.T) {
+	c := NewCollector()
+	ts := time.Unix(1600000000, 0)
+	min, max := 15.0, 60.0
+	r := testResult(ts)
+	r.Species = "ficus lyrata"
+	r.Conditions = []model.Condition{
+		{Dimension: model.FieldMoisture, State: model.ConditionOK, Value: 34, Min: &min, Max: &max},
+	}
+	c.ObserveResult(r)
+
+	assert.NoError(t, testutil.CollectAndCompare(
+		c,
+		strings.NewReader(`
+# HELP flowercare_condition State of a measured dimension compared to the thresholds of the plant species, 1 for the current state.
+# TYPE flowercare_condition gauge
+flowercare_condition{dimension="moisture",macaddress="c4:7c:8d:aa:bb:cc",name="fern",state="ok"} 1
+flowercare_condition{dimension="moisture",macaddress="c4:7c:8d:aa:bb:cc",name="fern",state="too_high"} 0
+flowercare_condition{dimension="moisture",macaddress="c4:7c:8d:aa:bb:cc",name="fern",state="too_low"} 0
+# HELP flowercare_plant_info Contains the plant species the sensor is assigned to.
+# TYPE flowercare_plant_info gauge
+flowercare_plant_info{macaddress="c4:7c:8d:aa:bb:cc",name="fern",species="ficus lyrata"} 1
+# HELP flowercare_threshold_max_moisture_percent Maximum preferred by the plant species. Soil relative moisture in percent.
+# TYPE flowercare_threshold_max_moisture_percent gauge
+flowercare_threshold_max_moisture_percent{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 60
+# HELP flowercare_threshold_min_moisture_percent Minimum preferred by the plant species. Soil relative moisture in percent.
+# TYPE flowercare_threshold_min_moisture_percent gauge
+flowercare_threshold_min_moisture_percent{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 15
+`),
+		"flowercare_condition",
+		"flowercare_plant_info",
+		"flowercare_threshold_min_moisture_percent",
+		"flowercare_threshold_max_moisture_percent",
+	))
+}
+
+func TestCollectorUnits(t *testing.T) {
+	u, err := model.ParseUnits("fahrenheit", "", "")
+	assert.NoError(t, err)
+	c := NewCollector().WithUnits(u)
+	min := 10.0
+	r := testResult(time.Unix(1600000000, 0))
+	r.Conditions = []model.Condition{
+		{Dimension: model.FieldTemperature, State: model.ConditionOK, Value: 21.5, Min: &min},
+	}
+	c.ObserveResult(r)
+
+	assert.NoError(t, testutil.CollectAndCompare(
+		c,
+		strings.NewReader(`
+# HELP flowercare_temperature_fahrenheit Ambient temperature in fahrenheit.
+# TYPE flowercare_temperature_fahrenheit gauge
+flowercare_temperature_fahrenheit{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 70.7
+# HELP flowercare_threshold_min_temperature_fahrenheit Minimum preferred by the plant species. Ambient temperature in fahrenheit.
+# TYPE flowercare_threshold_min_temperature_fahrenheit gauge
+flowercare_threshold_min_temperature_fahrenheit{macaddress="c4:7c:8d:aa:bb:cc",name="fern"} 50
+`),
+		"flowercare_temperature_fahrenheit",
+		"flowercare_temperature_celsius",
+		"flowercare_threshold_min_temperature_fahrenheit",
+		"flowercare_threshold_min_temperature_celsius",
+	))
+}
@@ -3,7 +3,9 @@ package tsdb
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"math"
+	"os"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -28,7 +30,7 @@ func metricNameLabel(o prometheus.Opts) string {
 	return prometheus.BuildFQName(o.Namespace, o.Subsystem, o.Name)
 }
 
-func resultToMetrics(r *model.Result) []*metric {
+func resultToMetrics(r *model.Result, units model.Units) []*metric {
 	var metrics []*metric
 
 	var t = timestamp.FromTime(time.Now())
@@ -68,33 +70,100 @@ func resultToMetrics(r *model.Result) []*metric {
 	}
 
 	if r.Measurement != nil {
+		for field, v := range r.Measurement.ValuesIn(units) {
+			metrics = append(metrics, &metric{
+				l: labels.NewBuilder(defaultLabels).
+					Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsMeasurement(field, units)))).
+					Labels(),
+				t: t,
+				v: v,
+			})
+		}
+	}
+
+	if r.Species != "" {
 		metrics = append(metrics, &metric{
 			l: labels.NewBuilder(defaultLabels).
-				Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsConductivity))).
-				Labels(),
-			t: t,
-			v: r.Measurement.Conductivity.Value(),
-		})
-		metrics = append(metrics, &metric{
-			l: labels.NewBuilder(defaultLabels).
-				Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsBrightness))).
+				Set(promoutput.LabelSpecies, r.Species).
+				Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsPlantInfo))).
 				Labels(),
 			t: t,
-			v: float64(*r.Measurement.Brightness),
+			v: 1.0,
 		})
+	}
+
+	for _, c := range r.Conditions {
+		c := units.ConvertCondition(c)
+		for _, state := range model.ConditionStates {
+			v := 0.0
+			if c.State == state {
+				v = 1.0
+			}
+			metrics = append(metrics, &metric{
+				l: labels.NewBuilder(defaultLabels).
+					Set(promoutput.LabelDimension, c.Dimension).
+					Set(promoutput.LabelState, state).
+					Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsCondition))).
+					Labels(),
+				t: t,
+				v: v,
+			})
+		}
+		if c.Min != nil {
+			metrics = append(metrics, &metric{
+				l: labels.NewBuilder(defaultLabels).
+					Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsThresholdMin(c.Dimension, units)))).
+					Labels(),
+				t: t,
+				v: *c.Min,
+			})
+		}
+		if c.Max != nil {
+			metrics = append(metrics, &metric{
+				l: labels.NewBuilder(defaultLabels).
+					Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsThresholdMax(c.Dimension, units)))).
+					Labels(),
+				t: t,
+				v: *c.Max,
+			})
+		}
+	}
+
+	if w := r.Watering; w != nil {
 		metrics = append(metrics, &metric{
 			l: labels.NewBuilder(defaultLabels).
-				Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsMoisture))).
+				Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsLastWatered))).
 				Labels(),
-			t: t,
-			v: float64(*r.Measurement.Moisture),
+			t: timestamp.FromTime(w.Timestamp),
+			v: float64(w.Timestamp.Unix()),
 		})
+	}
+
+	if l := r.DailyLight; l != nil {
+		for _, m := range []struct {
+			opts prometheus.GaugeOpts
+			v    float64
+		}{
+			{opts: promoutput.MetricOptsDailyLightIntegral, v: l.DLI},
+			{opts: promoutput.MetricOptsLightHours, v: l.LightHours},
+		} {
+			metrics = append(metrics, &metric{
+				l: labels.NewBuilder(defaultLabels).
+					Set(labels.MetricName, metricNameLabel(prometheus.Opts(m.opts))).
+					Labels(),
+				t: t,
+				v: m.v,
+			})
+		}
+	}
+
+	if f := r.MoistureForecast; f != nil {
 		metrics = append(metrics, &metric{
 			l: labels.NewBuilder(defaultLabels).
-				Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsTemperature))).
+				Set(labels.MetricName, metricNameLabel(prometheus.Opts(promoutput.MetricOptsMoisturePredictedThresholdCrossing))).
 				Labels(),
 			t: t,
-			v: r.Measurement.Temperature.Value(),
+			v: float64(f.ThresholdCrossing.Unix()),
 		})
 	}
 
@@ -103,29 +172,50 @@ func resultToMetrics(r *model.Result) []*metric {
 
 type TSDB struct {
 	logger log.Logger
+	units  model.Units
 }
 
 func New(logger log.Logger) *TSDB {
 	return &TSDB{
 		logger: level.Debug(logger),
+		units:  model.DefaultUnits(),
 	}
 }
 
+// WithUnits selects the units of the measurements, the metric names change
+// accordingly.
+func (t *TSDB) WithUnits(u model.Units) *TSDB {
+	t.units = u
+	return t
+}
+
 func (t *TSDB) Run(ctx context.Context, dir string) (chan *model.Result, chan error, error) {
 	resultsCh := make(chan *model.Result)
+
+	// the head requires a directory for its chunks, it is only used
+	// temporarily before writing the block
+	chunkDir, err := ioutil.TempDir("", "flowercare-tsdb-")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := tsdb.DefaultHeadOptions()
+	opts.ChunkRange = time.Duration(time.Hour * 24 * 365).Milliseconds() // a year should be enough
+	opts.ChunkDirRoot = chunkDir
 	head, err := tsdb.NewHead(
 		nil,
 		t.logger,
 		nil,
-		&tsdb.HeadOptions{
-			ChunkRange: time.Duration(time.Hour * 24 * 365).Milliseconds(), // a year should be enough
-		},
+		opts,
 	)
 	if err != nil {
+		_ = os.RemoveAll(chunkDir)
 		return nil, nil, err
 	}
 
 	if err := head.Init(math.MinInt64); err != nil {
+		_ = head.Close()
+		_ = os.RemoveAll(chunkDir)
 		return nil, nil, err
 	}
 
@@ -133,50 +223,59 @@ func (t *TSDB) Run(ctx context.Context, dir string) (chan *model.Result, chan er
 
 	go func() {
 		defer close(errCh)
+		defer os.RemoveAll(chunkDir)
 
-	results:
-		for result := range resultsCh {
-			a := head.Appender(ctx)
-			for _, m := range resultToMetrics(result) {
-				if _, err := a.Append(0, m.l, m.t, m.v); err != nil {
-					errCh <- err
-					break results
-				}
-			}
-			if err := a.Commit(); err != nil {
-				errCh <- err
-				break results
-			}
-
+		// only the first error is sent, as it is received once
+		err := t.write(ctx, dir, head, resultsCh)
+		if closeErr := head.Close(); err == nil && closeErr != nil {
+			err = closeErr
 		}
+		if err != nil {
+			errCh <- err
+		}
+	}()
 
-		seriesCount := head.NumSeries()
-		mint := head.MinTime()
-		maxt := head.MaxTime() + 1
-
-		_ = level.Info(t.logger).Log("msg", "flushing block", "series_count", seriesCount, "mint", timestamp.Time(mint), "maxt", timestamp.Time(maxt))
+	return resultsCh, errCh, nil
+}
 
-		// Flush head to disk as a block.
-		compactor, err := tsdb.NewLeveledCompactor(
-			ctx,
-			nil,
-			t.logger,
-			[]int64{int64(1000 * (2 * time.Hour).Seconds())}, // Does not matter, used only for planning.
-			chunkenc.NewPool())
-		if err != nil {
-			return
+// write appends the results to the head and flushes it to disk as a block,
+// once the results channel is closed or appending failed.
+func (t *TSDB) write(ctx context.Context, dir string, head *tsdb.Head, resultsCh chan *model.Result) error {
+	var appendErr error
+results:
+	for result := range resultsCh {
+		a := head.Appender(ctx)
+		for _, m := range resultToMetrics(result, t.units) {
+			if _, err := a.Append(0, m.l, m.t, m.v); err != nil {
+				appendErr = err
+				break results
+			}
 		}
-		if _, err := compactor.Write(dir, head, mint, maxt, nil); err != nil {
-			errCh <- fmt.Errorf("compactor write: %w", err)
-			return
+		if err := a.Commit(); err != nil {
+			appendErr = err
+			break results
 		}
+	}
 
-		if err := head.Close(); err != nil {
-			errCh <- err
-			return
-		}
+	seriesCount := head.NumSeries()
+	mint := head.MinTime()
+	maxt := head.MaxTime() + 1
 
-	}()
+	_ = level.Info(t.logger).Log("msg", "flushing block", "series_count", seriesCount, "mint", timestamp.Time(mint), "maxt", timestamp.Time(maxt))
 
-	return resultsCh, errCh, nil
+	// Flush head to disk as a block.
+	compactor, err := tsdb.NewLeveledCompactor(
+		ctx,
+		nil,
+		t.logger,
+		[]int64{int64(1000 * (2 * time.Hour).Seconds())}, // Does not matter, used only for planning.
+		chunkenc.NewPool())
+	if err != nil {
+		return fmt.Errorf("create compactor: %w", err)
+	}
+	if _, err := compactor.Write(dir, head, mint, maxt, nil); err != nil {
+		return fmt.Errorf("compactor write: %w", err)
+	}
+
+	return appendErr
 }
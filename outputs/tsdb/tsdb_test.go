@@ -0,0 +1,84 @@
+package tsdb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simonswine/mi-flora-exporter/miflora/model"
+)
+
+func testResult(t time.Time) *model.Result {
+	moisture := uint8(34)
+	return &model.Result{
+		Name:        "fern",
+		Address:     "c4:7c:8d:aa:bb:cc",
+		Timestamp:   &t,
+		Measurement: &model.Measurement{Moisture: &moisture},
+	}
+}
+
+// run writes a result to the directory and returns the error of the output.
+func run(t *testing.T, dir string) error {
+	resultsCh, errCh, err := New(log.NewNopLogger()).Run(context.Background(), dir)
+	require.NoError(t, err)
+
+	resultsCh <- testResult(time.Unix(1600000000, 0))
+	close(resultsCh)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+	require.LessOrEqual(t, len(errs), 1)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flowercare-tsdb-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, run(t, dir))
+	blocks, err := filepath.Glob(filepath.Join(dir, "*", "meta.json"))
+	require.NoError(t, err)
+	assert.Len(t, blocks, 1)
+}
+
+func TestRunWriteError(t *testing.T) {
+	f, err := ioutil.TempFile("", "flowercare-tsdb-test-")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	defer os.Remove(f.Name())
+
+	// the block can't be written below a file
+	assert.Error(t, run(t, f.Name()))
+}
+
+func TestResultToMetricsThresholds(t *testing.T) {
+	u, err := model.ParseUnits("fahrenheit", "", "")
+	require.NoError(t, err)
+	min, max := 10.0, 30.0
+	r := testResult(time.Unix(1600000000, 0))
+	r.Conditions = []model.Condition{
+		{Dimension: model.FieldTemperature, State: model.ConditionOK, Value: 21.5, Min: &min, Max: &max},
+	}
+
+	values := make(map[string]float64)
+	for _, m := range resultToMetrics(r, u) {
+		values[m.l.Get(labels.MetricName)] = m.v
+	}
+	assert.Equal(t, 50.0, values["flowercare_threshold_min_temperature_fahrenheit"])
+	assert.Equal(t, 86.0, values["flowercare_threshold_max_temperature_fahrenheit"])
+}
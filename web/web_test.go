@@ -0,0 +1,19 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if exp, act := http.StatusOK, w.Code; exp != act {
+		t.Errorf("unexpected status code exp: %v, act: %v", exp, act)
+	}
+	if !strings.Contains(w.Body.String(), "api/v1/sensors") {
+		t.Errorf("dashboard doesn't query the sensors API")
+	}
+}